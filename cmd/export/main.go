@@ -0,0 +1,94 @@
+// exportはノートをMarkdownファイルのzipアーカイブとして書き出す
+//
+//	go run ./cmd/export -out ./notes.zip -channel '#event/hackathon' -include-child
+//
+// GET /notes/exportと同じく，-userで指定したユーザーが一覧で読めるノートだけを書き出す．privateなノートは含めない
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/traP-jp/circuledge-backend/internal/notearchive"
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+	"github.com/traP-jp/circuledge-backend/pkg/config"
+	"github.com/traP-jp/circuledge-backend/pkg/database"
+)
+
+// tagFlags 複数回指定できるタグの条件
+type tagFlags []string
+
+func (t *tagFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagFlags) Set(v string) error {
+	*t = append(*t, v)
+
+	return nil
+}
+
+func main() {
+	out := flag.String("out", "notes.zip", "書き出すzipアーカイブのパス")
+	channel := flag.String("channel", "", "チャンネルのUUIDまたはパスで絞り込む")
+	includeChild := flag.Bool("include-child", false, "子孫チャンネルのノートも含める")
+	title := flag.String("title", "", "タイトルで絞り込む")
+	body := flag.String("body", "", "本文で絞り込む")
+	history := flag.Bool("history", false, "すべてのリビジョンも書き出す")
+	user := flag.String("user", "", "このユーザー（traQ ID）として書き出す．省略するとpublicなノートだけを書き出す")
+	var tags tagFlags
+	flag.Var(&tags, "tag", "タグで絞り込む（複数指定可）")
+	flag.Parse()
+
+	db, err := database.Setup(config.MySQL())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	es, err := elasticsearch.NewTypedClient(config.Elasticsearch())
+	if err != nil {
+		log.Fatal(err)
+	}
+	repo := repository.New(db, es, config.BotAccessToken(), nil, nil, nil)
+
+	ctx := context.Background()
+	params := repository.GetNotesParams{
+		IncludeChild: *includeChild,
+		Tags:         tags,
+		Title:        *title,
+		Body:         *body,
+		UserName:     *user,
+	}
+	if *channel != "" {
+		channelID, err := repo.ResolveChannel(ctx, *channel)
+		if err != nil {
+			log.Fatalf("resolve channel %q: %s", *channel, err)
+		}
+		params.Channel = channelID.String()
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	w := notearchive.NewWriter(f)
+	count := 0
+	err = repo.ExportNotes(ctx, params, *history, func(note notearchive.Note) error {
+		count++
+
+		return w.Add(note)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("exported %d notes to %s", count, *out)
+}
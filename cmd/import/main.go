@@ -0,0 +1,175 @@
+// importはHackMD（md.trap.jp）からエクスポートしたMarkdownファイルをノートとして取り込む
+//
+//	go run ./cmd/import -src ./export.zip -mapping ./mapping.yaml
+//
+// 作成日時・更新日時とタグを保ったまま取り込み，取り込み済みのファイルはスキップする
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/google/uuid"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+	"github.com/traP-jp/circuledge-backend/pkg/config"
+	"github.com/traP-jp/circuledge-backend/pkg/database"
+)
+
+func main() {
+	src := flag.String("src", "", "取り込むMarkdownファイルのディレクトリまたはzipアーカイブ")
+	mappingFile := flag.String("mapping", "", "チャンネルの対応を書いたYAMLファイル")
+	source := flag.String("source", "hackmd", "取り込み元の種類（重複取り込みの判定に使う）")
+	permission := flag.String("permission", "limited", "取り込んだノートの権限")
+	batchSize := flag.Int("batch", 100, "一度に書き込むノート数")
+	dryRun := flag.Bool("dry-run", false, "書き込まずに取り込み内容を表示する")
+	flag.Parse()
+
+	if *src == "" || *batchSize <= 0 {
+		flag.Usage()
+		log.Fatal("-src is required and -batch must be positive")
+	}
+
+	mapping, err := loadMapping(*mappingFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	files, err := readSource(*src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	notes := make([]repository.ImportNoteParams, 0, len(files))
+	channelNames := make([]string, 0, len(files))
+	for _, f := range files {
+		note, err := parseSourceFile(f)
+		if err != nil {
+			log.Printf("skip %s: %s", f.Path, err)
+
+			continue
+		}
+		note.Source = *source
+		note.Permission = *permission
+		notes = append(notes, note)
+		channelNames = append(channelNames, mapping.channelFor(f.Path, note.Tags))
+	}
+
+	if *dryRun {
+		for i, note := range notes {
+			fmt.Printf("%s\tchannel=%q\ttags=%v\tcreated=%s\tupdated=%s\n",
+				note.SourceID, channelNames[i], note.Tags, note.CreatedAt.Format(time.RFC3339), note.UpdatedAt.Format(time.RFC3339))
+		}
+
+		return
+	}
+
+	db, err := database.Setup(config.MySQL())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	es, err := elasticsearch.NewTypedClient(config.Elasticsearch())
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 取り込みではtraQへの告知を行わない
+	repo := repository.New(db, es, config.BotAccessToken(), nil, nil, nil)
+
+	ctx := context.Background()
+	if err := repo.SetupNoteIndex(ctx); err != nil {
+		log.Fatal(err)
+	}
+	channels := map[string]uuid.UUID{"": uuid.Nil}
+	for i, name := range channelNames {
+		if _, ok := channels[name]; !ok {
+			channelID, err := repo.ResolveChannel(ctx, name)
+			if err != nil {
+				log.Fatalf("resolve channel %q: %s", name, err)
+			}
+			channels[name] = channelID
+		}
+		notes[i].Channel = channels[name]
+	}
+
+	var created, skipped, failed int
+	for batch := range slices.Chunk(notes, *batchSize) {
+		results, err := repo.ImportNotes(ctx, batch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, res := range results {
+			switch {
+			case res.Err != nil:
+				failed++
+				log.Printf("failed %s: %s", res.SourceID, res.Err)
+			case res.Skipped:
+				skipped++
+			default:
+				created++
+				log.Printf("imported %s as %s", res.SourceID, res.NoteID)
+			}
+		}
+	}
+	log.Printf("done: %d imported, %d skipped, %d failed", created, skipped, failed)
+}
+
+// parseSourceFile front matterからID・タイトル・タグ・日時を読み取る
+func parseSourceFile(f sourceFile) (repository.ImportNoteParams, error) {
+	meta, _, err := notebody.SplitFrontMatter(f.Body)
+	if err != nil {
+		return repository.ImportNoteParams{}, err
+	}
+
+	tags := notebody.FrontMatterTags(meta)
+	for _, tag := range notebody.HackMDTags(f.Body) {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	sourceID := f.Path
+	if id, ok := meta["id"]; ok {
+		sourceID = fmt.Sprint(id)
+	}
+	title, _ := meta["title"].(string)
+
+	createdAt := metaTime(meta, f.ModTime, "created_at", "createdAt", "date")
+	updatedAt := metaTime(meta, f.ModTime, "updated_at", "updatedAt", "lastchange")
+	if createdAt.After(updatedAt) {
+		createdAt = updatedAt
+	}
+
+	return repository.ImportNoteParams{
+		SourceID:  sourceID,
+		Body:      f.Body,
+		Title:     title,
+		Tags:      tags,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+	}, nil
+}
+
+// metaTime front matterのkeysのうち最初に見つかった日時を返す．見つからなければfallbackを返す
+func metaTime(meta map[string]any, fallback time.Time, keys ...string) time.Time {
+	for _, key := range keys {
+		switch v := meta[key].(type) {
+		case time.Time:
+			return v
+		case int:
+			return time.Unix(int64(v), 0)
+		case string:
+			for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+				if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+					return t
+				}
+			}
+		}
+	}
+
+	return fallback
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// channelMapping 取り込むノートとチャンネルの対応
+//
+//	default: "#general"
+//	rules:
+//	  - path: "hackathon/"
+//	    channel: "#event/hackathon"
+//	  - tag: "sysad"
+//	    channel: "#team/SysAd"
+type channelMapping struct {
+	// Default どのルールにも当てはまらない場合のチャンネル（UUIDまたはチャンネルパス）
+	Default string        `yaml:"default"`
+	Rules   []mappingRule `yaml:"rules"`
+}
+
+// mappingRule ファイルパスの前方一致またはタグでチャンネルを決める規則．上から順に評価する
+type mappingRule struct {
+	Path    string `yaml:"path"`
+	Tag     string `yaml:"tag"`
+	Channel string `yaml:"channel"`
+}
+
+func loadMapping(name string) (*channelMapping, error) {
+	m := &channelMapping{}
+	if name == "" {
+		return m, nil
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read mapping file: %w", err)
+	}
+	if err := yaml.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("parse mapping file: %w", err)
+	}
+	for i, rule := range m.Rules {
+		if rule.Channel == "" || (rule.Path == "" && rule.Tag == "") {
+			return nil, fmt.Errorf("mapping rule #%d must have channel and either path or tag", i+1)
+		}
+	}
+
+	return m, nil
+}
+
+// channelFor ファイルのパスとタグから取り込み先のチャンネルを決める
+func (m *channelMapping) channelFor(filePath string, tags []string) string {
+	for _, rule := range m.Rules {
+		if rule.Path != "" && !strings.HasPrefix(filePath, rule.Path) {
+			continue
+		}
+		if rule.Tag != "" && !slices.Contains(tags, rule.Tag) {
+			continue
+		}
+
+		return rule.Channel
+	}
+
+	return m.Default
+}
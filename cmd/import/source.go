@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sourceFile 取り込み元のMarkdownファイル
+type sourceFile struct {
+	// Path 取り込み元のディレクトリ・アーカイブからの相対パス（区切り文字は`/`）
+	Path    string
+	Body    string
+	ModTime time.Time
+}
+
+// readSource ディレクトリまたはzipアーカイブからMarkdownファイルを読み込む
+func readSource(src string) ([]sourceFile, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readDir(src)
+	}
+	if strings.EqualFold(filepath.Ext(src), ".zip") {
+		return readZip(src)
+	}
+
+	return nil, fmt.Errorf("%s is neither a directory nor a zip archive", src)
+}
+
+func isMarkdown(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+
+	return ext == ".md" || ext == ".markdown"
+}
+
+func readDir(root string) ([]sourceFile, error) {
+	files := []sourceFile{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isMarkdown(p) {
+			return nil
+		}
+
+		body, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, sourceFile{
+			Path:    filepath.ToSlash(rel),
+			Body:    string(body),
+			ModTime: info.ModTime(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read directory %s: %w", root, err)
+	}
+
+	return files, nil
+}
+
+func readZip(name string) ([]sourceFile, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, fmt.Errorf("open zip archive %s: %w", name, err)
+	}
+	defer r.Close()
+
+	files := []sourceFile{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !isMarkdown(f.Name) {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", f.Name, err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		files = append(files, sourceFile{
+			Path:    f.Name,
+			Body:    string(body),
+			ModTime: f.Modified,
+		})
+	}
+
+	return files, nil
+}
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"context"
 	"log"
-	"os"
 
 	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/traP-jp/circuledge-backend/internal/blobstore"
 	"github.com/traP-jp/circuledge-backend/internal/handler"
+	"github.com/traP-jp/circuledge-backend/internal/notifier"
 	"github.com/traP-jp/circuledge-backend/internal/repository"
+	"github.com/traP-jp/circuledge-backend/internal/textextract"
+	"github.com/traP-jp/circuledge-backend/pkg/config"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
@@ -17,20 +21,42 @@ type Server struct {
 }
 
 func Inject(db *sqlx.DB) *Server {
-	espwd, _ := os.LookupEnv("ELASTIC_PASSWORD")
-	es, err := elasticsearch.NewTypedClient(elasticsearch.Config{
-		Addresses: []string{"http://elasticsearch:9200"},
-		Username:  "elastic",
-		Password:  espwd,
-	})
+	es, err := elasticsearch.NewTypedClient(config.Elasticsearch())
 	if err != nil {
 		log.Fatalf("Error creating the client: %s", err)
 	}
 
-	token, _ := os.LookupEnv("BOT_ACCESS_TOKEN")
+	token := config.BotAccessToken()
+
+	n := notifier.New(notifier.NewTraQMessageAPI(token), config.AppURL())
+
+	var blobs blobstore.BlobStore
+	switch config.BlobStoreType() {
+	case "s3":
+		blobs, err = blobstore.NewS3Store(config.S3())
+	default:
+		blobs, err = blobstore.NewLocalStore(config.BlobDir())
+	}
+	if err != nil {
+		log.Fatalf("Error creating the blob store: %s", err)
+	}
+
+	var ocr textextract.OCR
+	if command := config.OCRCommand(); len(command) > 0 {
+		ocr = &textextract.CommandOCR{Command: command[0], Args: command[1:]}
+	}
 
-	repo := repository.New(db, es, token)
-	h := handler.New(repo)
+	repo := repository.New(db, es, token, n, blobs, textextract.New(ocr))
+	if err := repo.SetupNoteIndex(context.Background()); err != nil {
+		log.Printf("setup notes index: %s", err)
+	}
+	go repo.WatchChannelAncestries(context.Background(), config.ChannelSyncInterval())
+	go repo.WatchNotifications(context.Background(), config.NotificationRetryInterval())
+	go repo.WatchAttachmentTexts(context.Background(), config.AttachmentTextInterval())
+	h := handler.New(repo, handler.BotConfig{
+		Name:              config.BotName(),
+		VerificationToken: config.BotVerificationToken(),
+	})
 
 	return &Server{
 		handler: h,
@@ -0,0 +1,88 @@
+// Package anchor コメントを付けた本文中の範囲を，後のリビジョンで本文が変わっても追従させる
+package anchor
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrInvalidRange = errors.New("invalid range")
+
+// Anchor 本文中の範囲．位置はUnicodeのコードポイント単位で数える
+type Anchor struct {
+	Start int
+	End   int
+	// Quote 範囲の本文
+	Quote string
+}
+
+// New 本文の[start, end)の範囲を指すAnchorを作る．空の範囲や本文の外を指す範囲はErrInvalidRangeを返す
+func New(body string, start int, end int) (Anchor, error) {
+	runes := []rune(body)
+	if start < 0 || end > len(runes) || start >= end {
+		return Anchor{}, ErrInvalidRange
+	}
+
+	return Anchor{Start: start, End: end, Quote: string(runes[start:end])}, nil
+}
+
+// Reanchor oldBodyを指すAnchorを，newBodyの同じ文字列を指すように移す
+// 範囲が変更箇所より前か後ろにあればずらすだけで済ませる．範囲が変更箇所に重なる場合は，
+// 元の位置に最も近い同じ文字列を探す．見つからない場合はfalseを返す
+func Reanchor(oldBody string, newBody string, a Anchor) (Anchor, bool) {
+	oldRunes, newRunes := []rune(oldBody), []rune(newBody)
+	quote := []rune(a.Quote)
+	if len(quote) == 0 {
+		return Anchor{}, false
+	}
+
+	if a.Start >= 0 && a.End <= len(oldRunes) && slices.Equal(oldRunes[a.Start:a.End], quote) {
+		prefix, suffix := commonAffixes(oldRunes, newRunes)
+		if a.End <= prefix {
+			return a, true
+		}
+		if a.Start >= len(oldRunes)-suffix {
+			delta := len(newRunes) - len(oldRunes)
+
+			return Anchor{Start: a.Start + delta, End: a.End + delta, Quote: a.Quote}, true
+		}
+	}
+
+	best := -1
+	for i := 0; i+len(quote) <= len(newRunes); i++ {
+		if !slices.Equal(newRunes[i:i+len(quote)], quote) {
+			continue
+		}
+		if best < 0 || abs(i-a.Start) < abs(best-a.Start) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return Anchor{}, false
+	}
+
+	return Anchor{Start: best, End: best + len(quote), Quote: a.Quote}, true
+}
+
+// commonAffixes 共通の接頭辞と接尾辞の長さを返す．両者は重ならない
+func commonAffixes(a []rune, b []rune) (int, int) {
+	n := min(len(a), len(b))
+	prefix := 0
+	for prefix < n && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	return prefix, suffix
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,88 @@
+package anchor
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	a, err := New("議事録: 予算は3万円", 5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Anchor{Start: 5, End: 7, Quote: "予算"}); a != want {
+		t.Errorf("New() = %+v, want %+v", a, want)
+	}
+
+	for _, r := range [][2]int{{-1, 2}, {3, 3}, {5, 4}, {0, 100}} {
+		if _, err := New("議事録: 予算は3万円", r[0], r[1]); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("New(%d, %d) error = %v, want ErrInvalidRange", r[0], r[1], err)
+		}
+	}
+}
+
+func TestReanchor(t *testing.T) {
+	oldBody := "議題\n予算は3万円\n会場は未定\n"
+	budget := Anchor{Start: 3, End: 9, Quote: "予算は3万円"}
+
+	tests := []struct {
+		name    string
+		newBody string
+		anchor  Anchor
+		want    Anchor
+		wantOK  bool
+	}{
+		{
+			name:    "edit after range",
+			newBody: "議題\n予算は3万円\n会場は部室\n",
+			anchor:  budget,
+			want:    budget,
+			wantOK:  true,
+		},
+		{
+			name:    "insert before range",
+			newBody: "# 定例\n議題\n予算は3万円\n会場は未定\n",
+			anchor:  budget,
+			want:    Anchor{Start: 8, End: 14, Quote: "予算は3万円"},
+			wantOK:  true,
+		},
+		{
+			name:    "edit inside range",
+			newBody: "議題\n予算は5万円\n会場は未定\n",
+			anchor:  budget,
+			wantOK:  false,
+		},
+		{
+			name:    "moved",
+			newBody: "議題\n会場は未定\n予算は3万円\n",
+			anchor:  budget,
+			want:    Anchor{Start: 9, End: 15, Quote: "予算は3万円"},
+			wantOK:  true,
+		},
+		{
+			name:    "nearest duplicate",
+			newBody: "予算は3万円\n議題\n予算は3万円\n会場は未定\n",
+			anchor:  Anchor{Start: 3, End: 9, Quote: "予算は3万円"},
+			want:    Anchor{Start: 10, End: 16, Quote: "予算は3万円"},
+			wantOK:  true,
+		},
+		{
+			name:    "stale offsets",
+			newBody: "議題\n予算は3万円\n",
+			anchor:  Anchor{Start: 0, End: 6, Quote: "予算は3万円"},
+			want:    Anchor{Start: 3, End: 9, Quote: "予算は3万円"},
+			wantOK:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Reanchor(oldBody, tt.newBody, tt.anchor)
+			if ok != tt.wantOK {
+				t.Fatalf("Reanchor() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("Reanchor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Package attachment ノートに添付するファイルの検証とサムネイルの生成を行う
+package attachment
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// MaxSize 添付ファイルの最大サイズ
+const MaxSize = 10 << 20
+
+const (
+	ContentTypeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	ContentTypePDF  = "application/pdf"
+)
+
+var (
+	ErrTooLarge        = errors.New("attachment is too large")
+	ErrUnsupportedType = errors.New("unsupported attachment type")
+)
+
+// allowedTypes 添付できるファイルの種類
+var allowedTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"text/plain":      true,
+	ContentTypePDF:    true,
+	ContentTypeDOCX:   true,
+	"application/zip": true,
+}
+
+// DetectContentType 内容から添付ファイルの種類を判定する
+// クライアントが申告した種類は信用せず，内容から判定できない場合に限りファイル名の拡張子を使う
+func DetectContentType(fileName string, data []byte) (string, error) {
+	if len(data) > MaxSize {
+		return "", ErrTooLarge
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	ext := strings.ToLower(path.Ext(fileName))
+	switch {
+	case contentType == "application/zip" && ext == ".docx":
+		// DOCXはzipとして判定される
+		contentType = ContentTypeDOCX
+	case contentType == "application/octet-stream" && ext == ".docx":
+		contentType = ContentTypeDOCX
+	}
+	if !allowedTypes[contentType] {
+		return "", ErrUnsupportedType
+	}
+
+	return contentType, nil
+}
+
+// SanitizeFileName Content-Dispositionに載せられるよう，パスや制御文字を取り除く
+func SanitizeFileName(fileName string) string {
+	fileName = path.Base(strings.ReplaceAll(fileName, `\`, "/"))
+	fileName = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+
+		return r
+	}, fileName)
+	if runes := []rune(fileName); len(runes) > 255 {
+		fileName = string(runes[:255])
+	}
+	if fileName == "" || fileName == "." || fileName == "/" {
+		return "file"
+	}
+
+	return fileName
+}
@@ -0,0 +1,91 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		data     []byte
+		want     string
+		wantErr  error
+	}{
+		{name: "png", fileName: "screenshot.jpg", data: testPNG(t, 1, 1), want: "image/png"},
+		{name: "pdf", fileName: "slide.pdf", data: []byte("%PDF-1.7\n"), want: ContentTypePDF},
+		{name: "docx", fileName: "report.docx", data: []byte("PK\x03\x04"), want: ContentTypeDOCX},
+		{name: "zip", fileName: "src.zip", data: []byte("PK\x03\x04"), want: "application/zip"},
+		{name: "text", fileName: "memo.md", data: []byte("# メモ"), want: "text/plain"},
+		{name: "html", fileName: "page.png", data: []byte("<html><script>alert(1)</script>"), wantErr: ErrUnsupportedType},
+		{name: "too large", fileName: "large.txt", data: make([]byte, MaxSize+1), wantErr: ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectContentType(tt.fileName, tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DetectContentType() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DetectContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := map[string]string{
+		"screenshot.png":      "screenshot.png",
+		`C:\Users\a\memo.txt`: "memo.txt",
+		"../../etc/passwd":    "passwd",
+		"a\"b\r\n.png":        "ab.png",
+		"":                    "file",
+	}
+	for fileName, want := range tests {
+		if got := SanitizeFileName(fileName); got != want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", fileName, got, want)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	data, err := Thumbnail("image/png", testPNG(t, 640, 160))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(ThumbnailSize, 80) {
+		t.Errorf("thumbnail size = %v, want %v", got, image.Pt(ThumbnailSize, 80))
+	}
+	if r, _, _, _ := img.At(10, 10).RGBA(); r>>8 != 255 {
+		t.Errorf("thumbnail color R = %d, want 255", r>>8)
+	}
+
+	if _, err := Thumbnail(ContentTypePDF, []byte("%PDF-1.7")); !errors.Is(err, ErrNoThumbnail) {
+		t.Errorf("Thumbnail(pdf) error = %v, want ErrNoThumbnail", err)
+	}
+}
@@ -0,0 +1,89 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	// サムネイルを作れる画像形式のデコーダーを登録する
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+const (
+	// ThumbnailSize サムネイルの幅と高さの上限
+	ThumbnailSize = 320
+	// maxThumbnailPixels デコードする画像の画素数の上限．展開すると巨大になる画像を避ける
+	maxThumbnailPixels = 40_000_000
+)
+
+// ErrNoThumbnail サムネイルを作れない種類のファイル
+var ErrNoThumbnail = errors.New("thumbnail is not available")
+
+// Thumbnail 画像を縦横比を保ってThumbnailSize以内に縮小したPNGを返す
+// PNG・JPEG・GIF以外のファイルではErrNoThumbnailを返す
+func Thumbnail(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return nil, ErrNoThumbnail
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image config: %w", err)
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return nil, ErrNoThumbnail
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resize(src, ThumbnailSize)); err != nil {
+		return nil, fmt.Errorf("encode thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// resize 縦横比を保ってsize以内に縮小する．縮小先の1画素に対応する元の画素の平均をとる
+func resize(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := bounds.Min.Y+y*h/dh, bounds.Min.Y+max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := bounds.Min.X+x*w/dw, bounds.Min.X+max((x+1)*w/dw, x*w/dw+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+
+	return dst
+}
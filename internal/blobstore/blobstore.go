@@ -0,0 +1,37 @@
+// Package blobstore 添付ファイルなどのバイナリをキーで保存する
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore キーを指定してバイナリを保存・取得・削除する
+// キーは`/`区切りのパスで，`..`や空の要素を含まない
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Get 保存されていない場合はErrNotFoundを返す
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 保存されていない場合も成功する
+	Delete(ctx context.Context, key string) error
+}
+
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.Contains(part, `\`) {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
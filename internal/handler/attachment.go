@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/traP-jp/circuledge-backend/internal/attachment"
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	AttachmentResponse struct {
+		repository.Attachment
+		URL string `json:"url"`
+		// ThumbnailURL 画像以外はサムネイルがないため空
+		ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+	}
+
+	GetAttachmentsResponse struct {
+		Attachments []AttachmentResponse `json:"attachments"`
+	}
+)
+
+func newAttachmentResponse(c echo.Context, a repository.Attachment) AttachmentResponse {
+	// /api/v1/notes/:noteId/attachmentsなどから，APIのパスの接頭辞を取り出す
+	prefix, _, _ := strings.Cut(c.Path(), "/notes/")
+	res := AttachmentResponse{Attachment: a, URL: prefix + "/attachments/" + a.ID}
+	if a.HasThumbnail {
+		res.ThumbnailURL = res.URL + "/thumbnail"
+	}
+
+	return res
+}
+
+// attachmentError リポジトリのエラーをHTTPのエラーに変換する
+func attachmentError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNoteNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "note not found")
+	case errors.Is(err, repository.ErrAttachmentNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "attachment not found")
+	case errors.Is(err, repository.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "permission denied")
+	case errors.Is(err, attachment.ErrTooLarge):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("attachment must not exceed %d bytes", attachment.MaxSize))
+	case errors.Is(err, attachment.ErrUnsupportedType):
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "unsupported attachment type")
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+}
+
+// POST /notes/:noteId/attachments
+// multipart/form-dataのfileフィールドでファイルを受け取る
+func (h *Handler) CreateAttachment(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "file is required").SetInternal(err)
+	}
+	if file.Size > attachment.MaxSize {
+		return attachmentError(attachment.ErrTooLarge)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file").SetInternal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, attachment.MaxSize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file").SetInternal(err)
+	}
+
+	a, err := h.repo.CreateAttachment(c.Request().Context(), repository.CreateAttachmentParams{
+		NoteID:   c.Param("noteId"),
+		FileName: file.Filename,
+		UserName: userName,
+		Data:     data,
+	})
+	if err != nil {
+		return attachmentError(err)
+	}
+
+	res := newAttachmentResponse(c, *a)
+	c.Response().Header().Set(echo.HeaderLocation, res.URL)
+
+	return c.JSON(http.StatusCreated, res)
+}
+
+// GET /notes/:noteId/attachments
+func (h *Handler) GetNoteAttachments(c echo.Context) error {
+	attachments, err := h.repo.GetNoteAttachments(c.Request().Context(), c.Param("noteId"), getUserName(c))
+	if err != nil {
+		return attachmentError(err)
+	}
+
+	res := GetAttachmentsResponse{Attachments: make([]AttachmentResponse, 0, len(attachments))}
+	for _, a := range attachments {
+		res.Attachments = append(res.Attachments, newAttachmentResponse(c, a))
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GET /attachments/:attachmentId
+func (h *Handler) GetAttachment(c echo.Context) error {
+	return h.serveAttachment(c, false)
+}
+
+// GET /attachments/:attachmentId/thumbnail
+func (h *Handler) GetAttachmentThumbnail(c echo.Context) error {
+	return h.serveAttachment(c, true)
+}
+
+func (h *Handler) serveAttachment(c echo.Context, thumbnail bool) error {
+	ctx := c.Request().Context()
+	a, err := h.repo.GetAttachment(ctx, c.Param("attachmentId"), getUserName(c))
+	if err != nil {
+		return attachmentError(err)
+	}
+	body, err := h.repo.OpenAttachment(ctx, a, thumbnail)
+	if err != nil {
+		return attachmentError(err)
+	}
+	defer body.Close()
+
+	contentType := a.ContentType
+	// 画像とPDF以外はブラウザで開かずにダウンロードさせる
+	disposition := "attachment"
+	if thumbnail {
+		contentType = "image/png"
+	}
+	if strings.HasPrefix(contentType, "image/") || contentType == attachment.ContentTypePDF {
+		disposition = "inline"
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": a.FileName}))
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set("Cache-Control", "private, max-age=86400")
+
+	return c.Stream(http.StatusOK, contentType, body)
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+	"github.com/traP-jp/circuledge-backend/internal/traqbot"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BotConfig traQ BOTの設定
+type BotConfig struct {
+	// Name BOTのtraQ ID．`@Name save`をコマンドとして扱う
+	Name string
+	// VerificationToken traQから送られてくるX-TRAQ-BOT-TOKENヘッダーの値
+	VerificationToken string
+}
+
+// POST /bot/events
+// traQ BOTのHTTPモードのイベントを受け取る．traQの再送を避けるため，重い処理は非同期に行いすぐに204を返す
+func (h *Handler) HandleBotEvent(c echo.Context) error {
+	token := c.Request().Header.Get(traqbot.HeaderToken)
+	if h.bot.VerificationToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.bot.VerificationToken)) != 1 {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid bot verification token")
+	}
+
+	switch c.Request().Header.Get(traqbot.HeaderEvent) {
+	case traqbot.EventMessageCreated:
+		payload := new(traqbot.MessageCreatedPayload)
+		if err := c.Bind(payload); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+		}
+		if payload.Message.User.Bot {
+			break
+		}
+		command, ok := traqbot.ParseCommand(payload.Message.PlainText, h.bot.Name)
+		if !ok {
+			break
+		}
+		go h.saveTraQMessages(payload.Message, command)
+
+	case traqbot.EventBotMessageStampsUpdated:
+		payload := new(traqbot.BotMessageStampsUpdatedPayload)
+		if err := c.Bind(payload); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+		}
+		if !slices.ContainsFunc(payload.Stamps, func(s traqbot.Stamp) bool {
+			return s.StampName == traqbot.UpdateStampName
+		}) {
+			break
+		}
+		go h.resyncTraQMessageNote(payload.MessageID)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) saveTraQMessages(message traqbot.Message, command traqbot.Command) {
+	noteID, err := h.repo.SaveTraQMessages(context.Background(), repository.SaveTraQMessagesParams{
+		ChannelID:        message.ChannelID,
+		CommandMessageID: message.ID,
+		Command:          command,
+		BotName:          h.bot.Name,
+	})
+	if err != nil {
+		log.Printf("save traQ message %s as note: %s", message.ID, err)
+
+		return
+	}
+	log.Printf("saved traQ message %s as note %s", message.ID, noteID)
+}
+
+func (h *Handler) resyncTraQMessageNote(botMessageID string) {
+	if err := h.repo.ResyncTraQMessageNote(context.Background(), botMessageID, h.bot.Name); err != nil {
+		log.Printf("resync note of traQ message %s: %s", botMessageID, err)
+	}
+}
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	duplicateNoteParams struct {
+		// Channel 複製先のチャンネル．省略した場合は複製元と同じチャンネル
+		Channel string `json:"channel"` // UUIDまたはチャンネルパス
+	}
+
+	bulkFilter struct {
+		Channel      string   `json:"channel"` // UUIDまたはチャンネルパス
+		IncludeChild bool     `json:"includeChild"`
+		Tags         []string `json:"tags"`
+		Title        string   `json:"title"`
+		Body         string   `json:"body"`
+		Mode         string   `json:"mode"` // title・body・tagsの検索モード
+		Op           string   `json:"op"`   // title・body・tagsの条件の組み合わせ方
+		NotTags      []string `json:"notTags"`
+		NotChannels  []string `json:"notChannels"` // UUIDまたはチャンネルパス
+	}
+
+	bulkNotesParams struct {
+		Action     string `json:"action"`
+		Channel    string `json:"channel"` // move-channelの移動先．UUIDまたはチャンネルパス
+		Permission string `json:"permission"`
+		Tag        string `json:"tag"`
+		// NoteIDs, Filter 対象のノート．どちらか一方を指定する
+		NoteIDs []string    `json:"noteIds"`
+		Filter  *bulkFilter `json:"filter"`
+	}
+
+	BulkNotesResponse struct {
+		Total     int                     `json:"total"`
+		Succeeded int                     `json:"succeeded"`
+		Skipped   int                     `json:"skipped"`
+		Failed    int                     `json:"failed"`
+		Results   []repository.BulkResult `json:"results"`
+	}
+)
+
+// noteLocation ノートのURLのパスを返す．/notes以下のルートから呼ぶ
+func noteLocation(c echo.Context, noteID string) string {
+	prefix, _, _ := strings.Cut(c.Path(), "/notes")
+
+	return prefix + "/notes/" + noteID
+}
+
+// POST /notes/:noteId/duplicate
+func (h *Handler) DuplicateNote(c echo.Context) error {
+	var params duplicateNoteParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	channelID, err := h.resolveChannel(c, params.Channel)
+	if err != nil {
+		return err
+	}
+	userName := getUserName(c)
+	if channelID != uuid.Nil {
+		exists, err := h.repo.ChannelExists(c.Request().Context(), channelID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+		if !exists {
+			return echo.NewHTTPError(http.StatusBadRequest, "channel not found: "+channelID.String())
+		}
+	}
+
+	note, err := h.repo.DuplicateNote(c.Request().Context(), c.Param("noteId"), repository.DuplicateNoteParams{
+		UserName: userName,
+		Channel:  channelID,
+	})
+	if errors.Is(err, repository.ErrNoteNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "note not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, noteLocation(c, note.ID.String()))
+
+	return c.JSON(http.StatusCreated, CreateNoteResponse{
+		ID:          note.ID.String(),
+		Channel:     note.Channel,
+		ChannelPath: note.ChannelPath,
+		Permission:  note.Permission,
+		Revision:    note.Revision,
+		Title:       note.Title,
+		Tags:        note.Tags,
+		Body:        note.Body,
+		References:  note.References,
+		FrontMatter: note.FrontMatter,
+		CreatedAt:   note.CreatedAt,
+		UpdatedAt:   note.UpdatedAt,
+	})
+}
+
+// bulkAction リクエストボディの操作を検証し，リポジトリに渡す形にする
+func (h *Handler) bulkAction(c echo.Context, params bulkNotesParams) (repository.BulkAction, error) {
+	action := repository.BulkAction{Type: params.Action}
+	switch params.Action {
+	case repository.BulkActionMoveChannel:
+		if params.Channel == "" {
+			return action, echo.NewHTTPError(http.StatusBadRequest, "channel is required")
+		}
+		channelID, err := h.resolveChannel(c, params.Channel)
+		if err != nil {
+			return action, err
+		}
+		exists, err := h.repo.ChannelExists(c.Request().Context(), channelID)
+		if err != nil {
+			return action, echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+		if !exists {
+			return action, echo.NewHTTPError(http.StatusBadRequest, "channel not found: "+params.Channel)
+		}
+		action.Channel = channelID
+	case repository.BulkActionChangePermission:
+		if !slices.Contains(permissions, params.Permission) {
+			return action, echo.NewHTTPError(http.StatusBadRequest, "invalid permission value")
+		}
+		action.Permission = params.Permission
+	case repository.BulkActionAddTag, repository.BulkActionRemoveTag:
+		action.Tag = strings.TrimSpace(params.Tag)
+		if action.Tag == "" {
+			return action, echo.NewHTTPError(http.StatusBadRequest, "tag is required")
+		}
+	case repository.BulkActionDelete:
+	default:
+		return action, echo.NewHTTPError(http.StatusBadRequest, "invalid action value")
+	}
+
+	return action, nil
+}
+
+// bulkNoteIDs リクエストボディで指定された対象のノートIDを返す
+func (h *Handler) bulkNoteIDs(c echo.Context, params bulkNotesParams) ([]string, error) {
+	if (len(params.NoteIDs) > 0) == (params.Filter != nil) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "specify either noteIds or filter")
+	}
+	if params.Filter == nil {
+		if len(params.NoteIDs) > repository.MaxBulkNotes {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "too many notes")
+		}
+
+		return slices.Compact(slices.Sorted(slices.Values(params.NoteIDs))), nil
+	}
+
+	filter := params.Filter
+	if filter.Channel == "" && len(filter.Tags) == 0 && filter.Title == "" && filter.Body == "" {
+		// 条件のないフィルタですべてのノートを操作しないようにする
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "filter must have at least one condition")
+	}
+	mode, err := searchMode(filter.Mode, slices.Concat([]string{filter.Title, filter.Body}, filter.Tags, filter.NotTags)...)
+	if err != nil {
+		return nil, err
+	}
+	op, err := searchOp(filter.Op)
+	if err != nil {
+		return nil, err
+	}
+	notChannels, err := h.resolveChannels(c, filter.NotChannels)
+	if err != nil {
+		return nil, err
+	}
+	channelID, err := h.resolveChannel(c, filter.Channel)
+	if err != nil {
+		return nil, err
+	}
+	channel := ""
+	if channelID != uuid.Nil {
+		channel = channelID.String()
+	}
+
+	noteIDs, err := h.repo.SearchNoteIDs(c.Request().Context(), repository.GetNotesParams{
+		UserName:     getUserName(c),
+		Channel:      channel,
+		IncludeChild: filter.IncludeChild,
+		Tags:         filter.Tags,
+		Title:        filter.Title,
+		Body:         filter.Body,
+		Mode:         mode,
+		Op:           op,
+		NotTags:      filter.NotTags,
+		NotChannels:  notChannels,
+	})
+	if errors.Is(err, repository.ErrTooManyNotes) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "too many notes match the filter")
+	}
+	if err != nil {
+		return nil, searchError(err)
+	}
+
+	return noteIDs, nil
+}
+
+// POST /notes/bulk
+// ノートごとの結果を返す．一部のノートの操作に失敗しても200を返す
+func (h *Handler) BulkUpdateNotes(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	var params bulkNotesParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	action, err := h.bulkAction(c, params)
+	if err != nil {
+		return err
+	}
+	noteIDs, err := h.bulkNoteIDs(c, params)
+	if err != nil {
+		return err
+	}
+
+	results := h.repo.BulkUpdateNotes(c.Request().Context(), noteIDs, action, userName)
+
+	return c.JSON(http.StatusOK, bulkResponse(results))
+}
@@ -1,14 +1,95 @@
 package handler
 
 import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+// channelWarningHeader 一覧から除外したチャンネルの理由を返すヘッダー
+const channelWarningHeader = "X-Channel-Warning"
+
+// GET /channels
+// レスポンスはチャンネルの配列のまま，除外したチャンネルの理由はヘッダーで返す
 func (h *Handler) GetChannels(c echo.Context) error {
-	res, err := h.repo.GetChannels()
+	includeArchivedStr := c.QueryParam("includeArchived")
+	if includeArchivedStr == "" {
+		includeArchivedStr = "false" // Default value
+	}
+	includeArchived, err := strconv.ParseBool(includeArchivedStr)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid includeArchived value").SetInternal(err)
+	}
+
+	channels, warnings, err := h.repo.GetChannels(c.Request().Context(), repository.GetChannelsParams{
+		UserName:        getUserName(c),
+		IncludeArchived: includeArchived,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+
+	for _, warning := range warnings {
+		c.Response().Header().Add(channelWarningHeader, warning)
+	}
+
+	return c.JSON(http.StatusOK, channels)
+}
+
+// GET /channels/tree
+func (h *Handler) GetChannelTree(c echo.Context) error {
+	hideEmptyStr := c.QueryParam("hideEmpty")
+	if hideEmptyStr == "" {
+		hideEmptyStr = "false" // Default value
+	}
+	hideEmpty, err := strconv.ParseBool(hideEmptyStr)
 	if err != nil {
-		return echo.NewHTTPError(500, err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid hideEmpty value").SetInternal(err)
+	}
+
+	res, err := h.repo.GetChannelTree(c.Request().Context(), hideEmpty)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// resolveChannel UUIDまたはチャンネルパスで指定されたチャンネルをUUIDに解決する
+// 空文字列の場合はuuid.Nilを返す
+func (h *Handler) resolveChannel(c echo.Context, channel string) (uuid.UUID, error) {
+	if channel == "" {
+		return uuid.Nil, nil
+	}
+
+	channelID, err := h.repo.ResolveChannel(c.Request().Context(), channel)
+	if errors.Is(err, repository.ErrChannelNotFound) {
+		return uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "channel not found: "+channel)
+	}
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+
+	return channelID, nil
+}
+
+// resolveChannels チャンネルのUUIDまたはパスのリストをUUIDの文字列のリストに変換する
+func (h *Handler) resolveChannels(c echo.Context, channelParams []string) ([]string, error) {
+	channels := make([]string, 0, len(channelParams))
+	for _, channelParam := range channelParams {
+		channelID, err := h.resolveChannel(c, channelParam)
+		if err != nil {
+			return nil, err
+		}
+		if channelID != uuid.Nil {
+			channels = append(channels, channelID.String())
+		}
 	}
 
-	return c.JSON(200, res)
+	return channels, nil
 }
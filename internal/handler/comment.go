@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/traP-jp/circuledge-backend/internal/anchor"
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxCommentLength コメントの最大文字数
+const maxCommentLength = 10000
+
+type (
+	createCommentThreadParams struct {
+		Body string `json:"body"`
+		// Revision Start・Endが指すリビジョン．省略した場合は最新リビジョン
+		Revision string `json:"revision"`
+		Start    *int   `json:"start"`
+		End      *int   `json:"end"`
+	}
+
+	replyCommentParams struct {
+		Body string `json:"body"`
+	}
+
+	resolveCommentThreadParams struct {
+		Resolved *bool `json:"resolved"`
+	}
+
+	GetCommentThreadsResponse struct {
+		Threads []repository.CommentThread `json:"threads"`
+	}
+)
+
+// commentError リポジトリのエラーをHTTPのエラーに変換する
+func commentError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNoteNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "note not found")
+	case errors.Is(err, repository.ErrCommentNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "comment not found")
+	case errors.Is(err, repository.ErrRevisionNotFound):
+		return echo.NewHTTPError(http.StatusBadRequest, "revision not found")
+	case errors.Is(err, anchor.ErrInvalidRange):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid range")
+	case errors.Is(err, repository.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "permission denied")
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+}
+
+func validateCommentBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "body is required")
+	}
+	if len([]rune(body)) > maxCommentLength {
+		return echo.NewHTTPError(http.StatusBadRequest, "body is too long")
+	}
+
+	return nil
+}
+
+// GET /notes/:noteId/comments
+func (h *Handler) GetCommentThreads(c echo.Context) error {
+	threads, err := h.repo.GetCommentThreads(c.Request().Context(), c.Param("noteId"), getUserName(c))
+	if err != nil {
+		return commentError(err)
+	}
+
+	return c.JSON(http.StatusOK, GetCommentThreadsResponse{Threads: threads})
+}
+
+// POST /notes/:noteId/comments
+// startとendを指定した場合は本文中の範囲へのコメント，省略した場合はノート全体へのコメントにする
+func (h *Handler) CreateCommentThread(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	var params createCommentThreadParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	if err := validateCommentBody(params.Body); err != nil {
+		return err
+	}
+	if (params.Start == nil) != (params.End == nil) {
+		return echo.NewHTTPError(http.StatusBadRequest, "start and end must be specified together")
+	}
+
+	thread, err := h.repo.CreateCommentThread(c.Request().Context(), repository.CreateCommentThreadParams{
+		NoteID:   c.Param("noteId"),
+		UserName: userName,
+		Body:     params.Body,
+		Revision: params.Revision,
+		Start:    params.Start,
+		End:      params.End,
+	})
+	if err != nil {
+		return commentError(err)
+	}
+
+	return c.JSON(http.StatusCreated, thread)
+}
+
+// POST /notes/:noteId/comments/:threadId/replies
+func (h *Handler) ReplyComment(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	var params replyCommentParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	if err := validateCommentBody(params.Body); err != nil {
+		return err
+	}
+
+	comment, err := h.repo.ReplyComment(c.Request().Context(), c.Param("noteId"), c.Param("threadId"), userName, params.Body)
+	if err != nil {
+		return commentError(err)
+	}
+
+	return c.JSON(http.StatusCreated, comment)
+}
+
+// POST /notes/:noteId/comments/:threadId/resolve
+// resolvedにfalseを指定すると未解決に戻す
+func (h *Handler) ResolveCommentThread(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	var params resolveCommentThreadParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	resolved := params.Resolved == nil || *params.Resolved
+
+	err := h.repo.ResolveCommentThread(c.Request().Context(), c.Param("noteId"), c.Param("threadId"), userName, resolved)
+	if err != nil {
+		return commentError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DELETE /notes/:noteId/comments/:threadId
+func (h *Handler) DeleteCommentThread(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+
+	err := h.repo.DeleteCommentThread(c.Request().Context(), c.Param("noteId"), c.Param("threadId"), userName)
+	if err != nil {
+		return commentError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DELETE /notes/:noteId/comments/:threadId/:commentId
+func (h *Handler) DeleteComment(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+
+	err := h.repo.DeleteComment(c.Request().Context(), c.Param("noteId"), c.Param("threadId"), c.Param("commentId"), userName)
+	if err != nil {
+		return commentError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
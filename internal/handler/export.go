@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/traP-jp/circuledge-backend/internal/notearchive"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GET /notes/export
+// GET /notesと同じ条件に一致するノートをMarkdownファイルのzipアーカイブとして返す
+// ノート数が多くてもメモリに載せないよう，1件ずつレスポンスに書き込む
+func (h *Handler) ExportNotes(c echo.Context) error {
+	params, err := h.parseGetNotesParams(c)
+	if err != nil {
+		return err
+	}
+	historyStr := c.QueryParam("history")
+	if historyStr == "" {
+		historyStr = "false" // Default value
+	}
+	history, err := strconv.ParseBool(historyStr)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid history value").SetInternal(err)
+	}
+
+	res := c.Response()
+	// 検索条件の誤りを400で返せるよう，最初のノートを書き込むまでステータスコードを送らない
+	writeHeader := func() {
+		if res.Committed {
+			return
+		}
+		res.Header().Set(echo.HeaderContentType, "application/zip")
+		res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="notes-%s.zip"`, time.Now().Format("20060102")))
+		res.WriteHeader(http.StatusOK)
+	}
+
+	w := notearchive.NewWriter(res)
+	err = h.repo.ExportNotes(c.Request().Context(), params, history, func(note notearchive.Note) error {
+		writeHeader()
+		if err := w.Add(note); err != nil {
+			return err
+		}
+		res.Flush()
+
+		return nil
+	})
+	if err != nil && !res.Committed {
+		return searchError(err)
+	}
+	if err != nil {
+		// ステータスコードは送信済みのため，アーカイブを閉じずに打ち切って不完全なことを伝える
+		log.Printf("export notes: %s", err)
+
+		return nil
+	}
+	writeHeader()
+
+	return w.Close()
+}
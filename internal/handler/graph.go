@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/traP-jp/circuledge-backend/internal/notegraph"
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type GetGraphResponse struct {
+	// Total 条件に一致するノートの総数
+	Total int64 `json:"total"`
+	// Truncated limitとoffsetによって条件に一致するノートの一部だけをグラフにした
+	Truncated bool             `json:"truncated"`
+	Nodes     []notegraph.Node `json:"nodes"`
+	Edges     []notegraph.Edge `json:"edges"`
+}
+
+// GET /graph
+// GET /notesと同じ条件に一致するノートと，そのリンク・タグ・チャンネルをグラフとして返す
+// format=graphmlまたはdotの場合はGraphMLまたはGraphvizのDOT形式で返す
+func (h *Handler) GetGraph(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "graphml" && format != "dot" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid format value")
+	}
+	params, err := h.parseGetNotesParams(c)
+	if err != nil {
+		return err
+	}
+	if params.Limit > repository.MaxGraphNotes {
+		return echo.NewHTTPError(http.StatusBadRequest, "limit must not exceed 1000")
+	}
+
+	g, total, err := h.repo.GetGraph(c.Request().Context(), params)
+	if err != nil {
+		return searchError(err)
+	}
+
+	res := c.Response()
+	switch format {
+	case "graphml":
+		res.Header().Set(echo.HeaderContentType, "application/graphml+xml; charset=UTF-8")
+		res.WriteHeader(http.StatusOK)
+
+		return notegraph.WriteGraphML(res, g)
+	case "dot":
+		res.Header().Set(echo.HeaderContentType, "text/vnd.graphviz; charset=UTF-8")
+		res.WriteHeader(http.StatusOK)
+
+		return notegraph.WriteDOT(res, g)
+	}
+
+	return c.JSON(http.StatusOK, GetGraphResponse{
+		Total:     total,
+		Truncated: int64(params.Offset+params.Limit) < total,
+		Nodes:     g.Nodes,
+		Edges:     g.Edges,
+	})
+}
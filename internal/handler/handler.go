@@ -8,11 +8,13 @@ import (
 
 type Handler struct {
 	repo *repository.Repository
+	bot  BotConfig
 }
 
-func New(repo *repository.Repository) *Handler {
+func New(repo *repository.Repository, bot BotConfig) *Handler {
 	return &Handler{
 		repo: repo,
+		bot:  bot,
 	}
 }
 
@@ -25,22 +27,84 @@ func (h *Handler) SetupRoutes(api *echo.Group) {
 
 	noteAPI := api.Group("/notes")
 	{
+		noteAPI.GET("/export", h.ExportNotes)
 		noteAPI.GET("/:noteId", h.GetNote)
 		noteAPI.DELETE("/:noteId", h.DeleteNote)
 		noteAPI.POST("", h.CreateNote)
+		noteAPI.POST("/bulk", h.BulkUpdateNotes)
+		noteAPI.POST("/:noteId/duplicate", h.DuplicateNote)
 		noteAPI.PUT("/:id", h.UpdateNote)
 		noteAPI.GET("/:noteId/history", h.GetNoteHistory)
+		noteAPI.GET("/:noteId/links", h.GetNoteLinks)
+		noteAPI.GET("/:noteId/backlinks", h.GetNoteBacklinks)
+		noteAPI.POST("/:noteId/attachments", h.CreateAttachment)
+		noteAPI.GET("/:noteId/attachments", h.GetNoteAttachments)
+		noteAPI.GET("/:noteId/comments", h.GetCommentThreads)
+		noteAPI.POST("/:noteId/comments", h.CreateCommentThread)
+		noteAPI.POST("/:noteId/comments/:threadId/replies", h.ReplyComment)
+		noteAPI.POST("/:noteId/comments/:threadId/resolve", h.ResolveCommentThread)
+		noteAPI.DELETE("/:noteId/comments/:threadId", h.DeleteCommentThread)
+		noteAPI.DELETE("/:noteId/comments/:threadId/:commentId", h.DeleteComment)
 		noteAPI.GET("", h.GetNotes)
 	}
 
+	attachmentAPI := api.Group("/attachments")
+	{
+		attachmentAPI.GET("/:attachmentId", h.GetAttachment)
+		attachmentAPI.GET("/:attachmentId/thumbnail", h.GetAttachmentThumbnail)
+	}
+
+	tagAPI := api.Group("/tags")
+	{
+		tagAPI.GET("", h.GetTags)
+		tagAPI.GET("/tree", h.GetTagTree)
+		tagAPI.POST("/:name/rename", h.RenameTag)
+		tagAPI.POST("/:name/merge", h.MergeTag)
+		tagAPI.GET("/:name/synonyms", h.GetTagSynonyms)
+		tagAPI.PUT("/:name/synonyms", h.SetTagSynonyms)
+		tagAPI.DELETE("/:name/synonyms", h.DeleteTagSynonyms)
+	}
+
+	templateAPI := api.Group("/templates")
+	{
+		templateAPI.GET("", h.GetTemplates)
+		templateAPI.POST("", h.CreateTemplate)
+		templateAPI.GET("/:templateId", h.GetTemplate)
+		templateAPI.PUT("/:templateId", h.UpdateTemplate)
+		templateAPI.DELETE("/:templateId", h.DeleteTemplate)
+	}
+
+	graphAPI := api.Group("/graph")
+	{
+		graphAPI.GET("", h.GetGraph)
+	}
+
 	meAPI := api.Group("/me")
 	{
 		meAPI.PUT("/settings", h.UpdateSettings)
 		meAPI.GET("/settings", h.GetSettings)
+		meAPI.GET("/stars", h.GetStars)
+		meAPI.PUT("/stars/:noteId", h.StarNote)
+		meAPI.DELETE("/stars/:noteId", h.UnstarNote)
 	}
 
 	channelsAPI := api.Group("/channels")
 	{
 		channelsAPI.GET("", h.GetChannels)
+		channelsAPI.GET("/tree", h.GetChannelTree)
+		channelsAPI.GET("/:channelId/pins", h.GetPinnedNotes)
+		channelsAPI.PUT("/:channelId/pins/:noteId", h.PinNote)
+		channelsAPI.DELETE("/:channelId/pins/:noteId", h.UnpinNote)
+	}
+
+	botAPI := api.Group("/bot")
+	{
+		botAPI.POST("/events", h.HandleBotEvent)
 	}
 }
+
+// getUserName リクエストしたユーザーのtraQ IDを取得する
+// NeoShowcaseのtraQ認証によってX-Forwarded-Userヘッダーに付与される．未認証の場合は空文字列を返す
+func getUserName(c echo.Context) string {
+	return c.Request().Header.Get("X-Forwarded-User")
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	GetNoteLinksResponse struct {
+		Links []repository.NoteLink `json:"links"`
+	}
+
+	GetNoteBacklinksResponse struct {
+		Total int64                 `json:"total"`
+		Notes []repository.Backlink `json:"notes"`
+	}
+)
+
+// GET /notes/:noteId/links
+func (h *Handler) GetNoteLinks(c echo.Context) error {
+	noteID := c.Param("noteId")
+	if noteID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "note ID is required")
+	}
+
+	links, err := h.repo.GetNoteLinks(c.Request().Context(), noteID, getUserName(c))
+	if errors.Is(err, repository.ErrNoteNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "note not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+
+	return c.JSON(http.StatusOK, GetNoteLinksResponse{Links: links})
+}
+
+// GET /notes/:noteId/backlinks
+func (h *Handler) GetNoteBacklinks(c echo.Context) error {
+	noteID := c.Param("noteId")
+	if noteID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "note ID is required")
+	}
+
+	backlinks, err := h.repo.GetNoteBacklinks(c.Request().Context(), noteID, getUserName(c))
+	if errors.Is(err, repository.ErrNoteNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "note not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+
+	return c.JSON(http.StatusOK, GetNoteBacklinksResponse{
+		Total: int64(len(backlinks)),
+		Notes: backlinks,
+	})
+}
@@ -7,7 +7,8 @@ import (
 )
 
 type UpdateSettingsParams struct {
-	DefaultChannel string `json:"defaultChannel"`
+	DefaultChannel string `json:"defaultChannel"` // UUIDまたはチャンネルパス
+	NotifyNotes    *bool  `json:"notifyNotes"`    // 編集したノートをtraQに告知するかどうか
 }
 
 func (h *Handler) UpdateSettings(c echo.Context) error {
@@ -26,7 +27,25 @@ func (h *Handler) UpdateSettings(c echo.Context) error {
 	if err := c.Bind(settings); err != nil {
 		return echo.NewHTTPError(400, "invalid request body").SetInternal(err)
 	}
-	session.Values["default_channel"] = settings.DefaultChannel
+	defaultChannel := ""
+	if settings.DefaultChannel != "" {
+		channelID, err := h.resolveChannel(c, settings.DefaultChannel)
+		if err != nil {
+			return err
+		}
+		defaultChannel = channelID.String()
+	}
+	session.Values["default_channel"] = defaultChannel
+
+	if settings.NotifyNotes != nil {
+		userName := getUserName(c)
+		if userName == "" {
+			return echo.NewHTTPError(401, "notifyNotes requires login")
+		}
+		if err := h.repo.SetUserNotificationEnabled(c.Request().Context(), userName, *settings.NotifyNotes); err != nil {
+			return echo.NewHTTPError(500, "failed to save settings").SetInternal(err)
+		}
+	}
 
 	if err := session.Save(c.Request(), c.Response()); err != nil {
 		return echo.NewHTTPError(500, "failed to save session").SetInternal(err)
@@ -46,8 +65,17 @@ func (h *Handler) GetSettings(c echo.Context) error {
 		defaultChannel = ""
 	}
 
-	res := map[string]string{
+	notifyNotes := true
+	if userName := getUserName(c); userName != "" {
+		notifyNotes, err = h.repo.GetUserNotificationEnabled(c.Request().Context(), userName)
+		if err != nil {
+			return echo.NewHTTPError(500, "failed to get settings").SetInternal(err)
+		}
+	}
+
+	res := map[string]any{
 		"defaultChannel": defaultChannel,
+		"notifyNotes":    notifyNotes,
 	}
 
 	return c.JSON(200, res)
@@ -1,34 +1,65 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"github.com/traP-jp/circuledge-backend/internal/noterender"
 	"github.com/traP-jp/circuledge-backend/internal/repository"
+	"github.com/traP-jp/circuledge-backend/internal/searchpattern"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
 
+// permissions ノートの権限として指定できる値
+var permissions = []string{"public", "limited", "private"}
+
 // スキーマ定義
 type (
 	CreateNoteResponse struct {
-		ID         string `json:"id"`
-		Channel    string `json:"channel"`
-		Permission string `json:"permission"`
-		Revision   string `json:"revision"`
-		Body       string `json:"body"`
+		ID          string `json:"id"`
+		Channel     string `json:"channel"`
+		ChannelPath string `json:"channelPath,omitempty"`
+		Permission  string `json:"permission"`
+		Revision    string `json:"revision"`
+		// Title, Tags, CreatedAt, UpdatedAt 作成したノートの情報（POST /notesのみ）
+		Title     string   `json:"title,omitempty"`
+		Tags      []string `json:"tags,omitempty"`
+		CreatedAt int32    `json:"createdAt,omitempty"`
+		UpdatedAt int32    `json:"updatedAt,omitempty"`
+		Body      string   `json:"body"`
+		// References 本文中のtraQのユーザー・チャンネルなどへの参照（GET /notes/:noteIdのみ）
+		References []notebody.Reference `json:"references,omitempty"`
+		// FrontMatter 本文のYAML front matter（GET /notes/:noteIdのみ）
+		FrontMatter map[string]any `json:"frontMatter,omitempty"`
+	}
+
+	createNoteParams struct {
+		Channel    string   `json:"channel"` // UUIDまたはチャンネルパス
+		Permission string   `json:"permission"`
+		Body       string   `json:"body"`
+		Tags       []string `json:"tags"`
+		// TemplateID 指定した場合，テンプレートを展開して最初のリビジョンにする
+		TemplateID string `json:"templateId"`
+		// Variables テンプレートの組み込みでない変数の値
+		Variables map[string]string `json:"variables"`
 	}
 
 	updateNoteParams struct {
-		Channel    uuid.UUID `json:"channel"`
+		Channel    string    `json:"channel"` // UUIDまたはチャンネルパス
 		Permission string    `json:"permission"`
 		Revision   uuid.UUID `json:"revision"`
 		Body       string    `json:"body"`
 		Tags       []string  `json:"tags"`
 		Title      string    `json:"title"`
 		Summary    string    `json:"summary"`
+		Notify     *bool     `json:"notify"` // traQへの告知を行うかどうか．省略した場合は変更しない
 	}
 
 	GetNoteHistoryResponse struct {
@@ -43,11 +74,16 @@ type (
 )
 
 // GET /notes/:noteId
+// format=htmlの場合は本文をサニタイズ済みのHTMLとして返す
 func (h *Handler) GetNote(c echo.Context) error {
 	noteID := c.Param("noteId")
 	if noteID == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "note ID is required")
 	}
+	format := c.QueryParam("format")
+	if format != "" && format != "json" && format != "html" {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid format value")
+	}
 
 	note, err := h.repo.GetNote(c.Request().Context(), noteID)
 	if err != nil {
@@ -58,12 +94,28 @@ func (h *Handler) GetNote(c echo.Context) error {
 
 		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
 	}
+	// 読めないノートは存在を明かさない
+	if !repository.CanReadNote(note.Permission, getUserName(c)) {
+		return echo.NewHTTPError(http.StatusNotFound, "note not found")
+	}
+
+	if format == "html" {
+		html, err := noterender.Render(note.Body)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+
+		return c.HTML(http.StatusOK, html)
+	}
 
 	res := CreateNoteResponse{
-		Revision:   note.Revision,
-		Channel:    note.Channel,
-		Permission: note.Permission,
-		Body:       note.Body,
+		Revision:    note.Revision,
+		Channel:     note.Channel,
+		ChannelPath: note.ChannelPath,
+		Permission:  note.Permission,
+		Body:        note.Body,
+		References:  note.References,
+		FrontMatter: note.FrontMatter,
 	}
 
 	return c.JSON(http.StatusOK, res)
@@ -89,37 +141,104 @@ func (h *Handler) DeleteNote(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent) //204
 }
 
+// POST /notes
+// channelを省略した場合は設定したデフォルトのチャンネルに作成する
 func (h *Handler) CreateNote(c echo.Context) error {
-	session, err := session.Get("session", c)
+	params := new(createNoteParams)
+	if err := c.Bind(params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	if params.Permission == "" {
+		params.Permission = "limited" // Default value
+	}
+	if !slices.Contains(permissions, params.Permission) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid permission value")
+	}
+	if params.TemplateID != "" && params.Body != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "templateId and body cannot be specified together")
+	}
+
+	channelID, err := h.resolveChannel(c, params.Channel)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to get session").SetInternal(err)
-	}
-	// normalize default channel value into a uuid.UUID
-	channelUUID := uuid.Nil
-	if defaultChannel := session.Values["default_channel"]; defaultChannel != nil {
-		switch v := defaultChannel.(type) {
-		case string:
-			if parsed, err := uuid.Parse(v); err == nil {
-				channelUUID = parsed
-			}
-		case uuid.UUID:
-			channelUUID = v
+		return err
+	}
+	if channelID == uuid.Nil {
+		channelID, err = defaultChannel(c)
+		if err != nil {
+			return err
 		}
 	}
-
-	noteID, channelID, permission, revisionID, err := h.repo.CreateNote(c.Request().Context(), channelUUID)
+	if channelID == uuid.Nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "channel is required")
+	}
+	userName := getUserName(c)
+	exists, err := h.repo.ChannelExists(c.Request().Context(), channelID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
 	}
-	res := CreateNoteResponse{
-		ID:         noteID.String(),
-		Channel:    channelID.String(),
-		Permission: permission,
-		Revision:   revisionID.String(),
+	if !exists {
+		return echo.NewHTTPError(http.StatusBadRequest, "channel not found: "+channelID.String())
 	}
 
-	return c.JSON(http.StatusOK, res)
+	createParams := repository.CreateNoteParams{
+		UserName:   userName,
+		Channel:    channelID,
+		Permission: params.Permission,
+		Tags:       params.Tags,
+		Body:       params.Body,
+	}
+	if params.TemplateID != "" {
+		if userName == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+		}
+		createParams.Template = &repository.RenderTemplateParams{
+			TemplateID: params.TemplateID,
+			Variables:  params.Variables,
+		}
+	}
+
+	note, err := h.repo.CreateNote(c.Request().Context(), createParams)
+	if err != nil {
+		// テンプレートの展開はノートの作成と同じトランザクションで行う．それ以外のエラーは500になる
+		return templateError(err)
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, noteLocation(c, note.ID.String()))
+
+	return c.JSON(http.StatusCreated, CreateNoteResponse{
+		ID:          note.ID.String(),
+		Channel:     note.Channel,
+		ChannelPath: note.ChannelPath,
+		Permission:  note.Permission,
+		Revision:    note.Revision,
+		Title:       note.Title,
+		Tags:        note.Tags,
+		Body:        note.Body,
+		References:  note.References,
+		FrontMatter: note.FrontMatter,
+		CreatedAt:   note.CreatedAt,
+		UpdatedAt:   note.UpdatedAt,
+	})
 }
+
+// defaultChannel セッションに保存したデフォルトのチャンネルを取得する．未設定の場合はuuid.Nilを返す
+func defaultChannel(c echo.Context) (uuid.UUID, error) {
+	session, err := session.Get("session", c)
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get session").SetInternal(err)
+	}
+	switch v := session.Values["default_channel"].(type) {
+	case string:
+		if parsed, err := uuid.Parse(v); err == nil {
+			return parsed, nil
+		}
+	case uuid.UUID:
+		return v, nil
+	}
+
+	return uuid.Nil, nil
+}
+
 func (h *Handler) UpdateNote(c echo.Context) error {
 	noteID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -129,9 +248,15 @@ func (h *Handler) UpdateNote(c echo.Context) error {
 	if err := c.Bind(params); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
 	}
+	channelID, err := h.resolveChannel(c, params.Channel)
+	if err != nil {
+		return err
+	}
 
 	err = h.repo.UpdateNote(c.Request().Context(), noteID, repository.UpdateNoteParams{
-		Channel:    params.Channel,
+		UserName:   getUserName(c),
+		Notify:     params.Notify,
+		Channel:    channelID,
 		Permission: params.Permission,
 		Revision:   params.Revision,
 		Body:       params.Body,
@@ -185,26 +310,117 @@ func (h *Handler) GetNoteHistory(c echo.Context) error {
 	})
 }
 
-func (h *Handler) GetNotes(c echo.Context) error {
-	channel := c.QueryParam("channel")
+// searchMode 検索モードを読み取る．regexモードでは検索語が安全な正規表現か確かめる
+func searchMode(mode string, patterns ...string) (string, error) {
+	mode, err := searchpattern.ParseMode(mode)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if mode != searchpattern.ModeRegex {
+		return mode, nil
+	}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if err := searchpattern.Validate(pattern); err != nil {
+			return "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	return mode, nil
+}
+
+// searchOp タイトル・本文・タグの条件の組み合わせ方を読み取る．空の場合はandにする
+func searchOp(op string) (string, error) {
+	switch op {
+	case "":
+		return repository.SearchOpAnd, nil
+	case repository.SearchOpAnd, repository.SearchOpOr:
+		return op, nil
+	}
+
+	return "", echo.NewHTTPError(http.StatusBadRequest, "invalid op value (must be and or or)")
+}
+
+// parseGetNotesParams GET /notesとGET /notes/exportで共通の検索条件を読み取る
+func (h *Handler) parseGetNotesParams(c echo.Context) (repository.GetNotesParams, error) {
+	channel := ""
+	if channelParam := c.QueryParam("channel"); channelParam != "" {
+		channelID, err := h.resolveChannel(c, channelParam)
+		if err != nil {
+			return repository.GetNotesParams{}, err
+		}
+		channel = channelID.String()
+	}
 
 	includeChildStr := c.QueryParam("includeChild")
 	if includeChildStr != "" && includeChildStr != "true" && includeChildStr != "false" {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid includeChild value")
+		return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid includeChild value")
 	}
 	if includeChildStr == "" {
 		includeChildStr = "false" // Default value
 	}
 	includeChild, err := strconv.ParseBool(includeChildStr)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid includeChild value").SetInternal(err)
+		return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid includeChild value").SetInternal(err)
+	}
+	mentionsMeStr := c.QueryParam("mentionsMe")
+	if mentionsMeStr == "" {
+		mentionsMeStr = "false" // Default value
+	}
+	mentionsMe, err := strconv.ParseBool(mentionsMeStr)
+	if err != nil {
+		return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid mentionsMe value").SetInternal(err)
+	}
+	mentionedUser := ""
+	if mentionsMe {
+		mentionedUser = getUserName(c)
+		if mentionedUser == "" {
+			return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusUnauthorized, "mentionsMe requires login")
+		}
+	}
+	starredStr := c.QueryParam("starred")
+	if starredStr == "" {
+		starredStr = "false" // Default value
+	}
+	starred, err := strconv.ParseBool(starredStr)
+	if err != nil {
+		return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid starred value").SetInternal(err)
+	}
+	starredBy := ""
+	if starred {
+		starredBy = getUserName(c)
+		if starredBy == "" {
+			return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusUnauthorized, "starred requires login")
+		}
+	}
+	// fm.<key>=<value>の形式でfront matterの値を指定する
+	frontMatter := map[string][]string{}
+	for name, values := range c.QueryParams() {
+		if key, ok := strings.CutPrefix(name, "fm."); ok && key != "" {
+			frontMatter[key] = values
+		}
 	}
 	tags := c.QueryParams()["tag"]
 	title := c.QueryParam("title")
 	body := c.QueryParam("body")
+	notTags := c.QueryParams()["notTag"]
+	mode, err := searchMode(c.QueryParam("mode"), slices.Concat([]string{title, body}, tags, notTags)...)
+	if err != nil {
+		return repository.GetNotesParams{}, err
+	}
+	op, err := searchOp(c.QueryParam("op"))
+	if err != nil {
+		return repository.GetNotesParams{}, err
+	}
+	notChannels, err := h.resolveChannels(c, c.QueryParams()["notChannel"])
+	if err != nil {
+		return repository.GetNotesParams{}, err
+	}
 	sortkey := c.QueryParam("sortKey")
-	if sortkey != "" && sortkey != "dateAsc" && sortkey != "dateDesc" && sortkey != "titleAsc" && sortkey != "titleDesc" {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid sortKey value")
+	if sortkey != "" && sortkey != "dateAsc" && sortkey != "dateDesc" && sortkey != "titleAsc" && sortkey != "titleDesc" && sortkey != "popular" {
+		return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid sortKey value")
 	}
 	if sortkey == "" {
 		sortkey = "dateDesc" // Default sort key
@@ -219,25 +435,51 @@ func (h *Handler) GetNotes(c echo.Context) error {
 	}
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil || limit <= 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid limit value")
+		return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid limit value")
 	}
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil || offset < 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid offset value")
+		return repository.GetNotesParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid offset value")
 	}
 	params := repository.GetNotesParams{
-		Channel:      channel,
-		IncludeChild: includeChild,
-		Tags:         tags,
-		Title:        title,
-		Body:         body,
-		SortKey:      sortkey,
-		Limit:        limit,
-		Offset:       offset,
+		Channel:       channel,
+		IncludeChild:  includeChild,
+		MentionedUser: mentionedUser,
+		StarredBy:     starredBy,
+		UserName:      getUserName(c),
+		FrontMatter:   frontMatter,
+		Tags:          tags,
+		Title:         title,
+		Body:          body,
+		Mode:          mode,
+		Op:            op,
+		NotTags:       notTags,
+		NotChannels:   notChannels,
+		SortKey:       sortkey,
+		Limit:         limit,
+		Offset:        offset,
+	}
+
+	return params, nil
+}
+
+// searchError ノートの検索のエラーをHTTPのエラーに変換する．ESが受け付けなかった検索条件は400にする
+func searchError(err error) error {
+	if errors.Is(err, repository.ErrInvalidSearch) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+}
+
+func (h *Handler) GetNotes(c echo.Context) error {
+	params, err := h.parseGetNotesParams(c)
+	if err != nil {
+		return err
 	}
 	notes, total, err := h.repo.GetNotes(c.Request().Context(), params)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		return searchError(err)
 	}
 
 	return c.JSON(http.StatusOK, GetNotesResponse{
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type GetPinnedNotesResponse struct {
+	Notes []repository.PinnedNote `json:"notes"`
+}
+
+// starError リポジトリのエラーをHTTPのエラーに変換する
+func starError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNoteNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "note not found")
+	case errors.Is(err, repository.ErrNoteNotInChannel):
+		return echo.NewHTTPError(http.StatusBadRequest, "note is not in the channel")
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+}
+
+// GET /me/stars
+// GET /notesと同じ条件で，スターを付けたノートに絞り込む
+func (h *Handler) GetStars(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	params, err := h.parseGetNotesParams(c)
+	if err != nil {
+		return err
+	}
+	params.StarredBy = userName
+
+	notes, total, err := h.repo.GetNotes(c.Request().Context(), params)
+	if err != nil {
+		return searchError(err)
+	}
+
+	return c.JSON(http.StatusOK, GetNotesResponse{
+		Total: total,
+		Notes: notes,
+	})
+}
+
+// PUT /me/stars/:noteId
+func (h *Handler) StarNote(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	if err := h.repo.StarNote(c.Request().Context(), userName, c.Param("noteId")); err != nil {
+		return starError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DELETE /me/stars/:noteId
+func (h *Handler) UnstarNote(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	if err := h.repo.UnstarNote(c.Request().Context(), userName, c.Param("noteId")); err != nil {
+		return starError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GET /channels/:channelId/pins
+func (h *Handler) GetPinnedNotes(c echo.Context) error {
+	channelID, err := h.resolveChannel(c, c.Param("channelId"))
+	if err != nil {
+		return err
+	}
+
+	notes, err := h.repo.GetPinnedNotes(c.Request().Context(), channelID, getUserName(c))
+	if err != nil {
+		return starError(err)
+	}
+
+	return c.JSON(http.StatusOK, GetPinnedNotesResponse{Notes: notes})
+}
+
+// PUT /channels/:channelId/pins/:noteId
+func (h *Handler) PinNote(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	channelID, err := h.resolveChannel(c, c.Param("channelId"))
+	if err != nil {
+		return err
+	}
+	if err := h.repo.PinNote(c.Request().Context(), channelID, c.Param("noteId"), userName); err != nil {
+		return starError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DELETE /channels/:channelId/pins/:noteId
+func (h *Handler) UnpinNote(c echo.Context) error {
+	if getUserName(c) == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	channelID, err := h.resolveChannel(c, c.Param("channelId"))
+	if err != nil {
+		return err
+	}
+	if err := h.repo.UnpinNote(c.Request().Context(), channelID, c.Param("noteId")); err != nil {
+		return starError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	renameTagParams struct {
+		Name string `json:"name"`
+	}
+
+	mergeTagParams struct {
+		Into string `json:"into"`
+	}
+
+	tagSynonymsParams struct {
+		Synonyms []string `json:"synonyms"`
+	}
+
+	GetTagsResponse struct {
+		Tags []repository.TagCount `json:"tags"`
+	}
+
+	GetTagTreeResponse struct {
+		Tags []repository.TagNode `json:"tags"`
+	}
+
+	TagSynonymsResponse struct {
+		Tag      string   `json:"tag"`
+		Synonyms []string `json:"synonyms"`
+	}
+)
+
+// tagError リポジトリのエラーをHTTPのエラーに変換する
+func tagError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrTagNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "tag not found")
+	case errors.Is(err, repository.ErrTagExists):
+		return echo.NewHTTPError(http.StatusConflict, "tag already exists; use merge instead")
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+}
+
+// validateTagName タグ行やfront matterに書けるタグ名か確かめ，前後の空白を除いて返す
+func validateTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "tag name is required")
+	}
+	if strings.ContainsAny(name, "`,\n") {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "tag name must not contain backquotes, commas or newlines")
+	}
+
+	return name, nil
+}
+
+// tagParam パスのタグ名を取り出す．`/`を含むタグは%2Fとしてエスケープして指定する
+func tagParam(c echo.Context) (string, error) {
+	name, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid tag name").SetInternal(err)
+	}
+
+	return validateTagName(name)
+}
+
+// bulkResponse ノートごとの結果を集計する
+func bulkResponse(results []repository.BulkResult) BulkNotesResponse {
+	res := BulkNotesResponse{Total: len(results), Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case repository.BulkStatusOK:
+			res.Succeeded++
+		case repository.BulkStatusSkipped:
+			res.Skipped++
+		case repository.BulkStatusError:
+			res.Failed++
+		}
+	}
+
+	return res
+}
+
+// GET /tags
+func (h *Handler) GetTags(c echo.Context) error {
+	limit := 100 // Default limit
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > repository.MaxTags {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid limit value")
+		}
+	}
+
+	tags, err := h.repo.GetTags(c.Request().Context(), limit)
+	if err != nil {
+		return tagError(err)
+	}
+
+	return c.JSON(http.StatusOK, GetTagsResponse{Tags: tags})
+}
+
+// GET /tags/tree
+func (h *Handler) GetTagTree(c echo.Context) error {
+	tags, err := h.repo.GetTagTree(c.Request().Context())
+	if err != nil {
+		return tagError(err)
+	}
+
+	return c.JSON(http.StatusOK, GetTagTreeResponse{Tags: tags})
+}
+
+// POST /tags/:name/rename
+func (h *Handler) RenameTag(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	tag, err := tagParam(c)
+	if err != nil {
+		return err
+	}
+	var params renameTagParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	newTag, err := validateTagName(params.Name)
+	if err != nil {
+		return err
+	}
+	if newTag == tag {
+		return echo.NewHTTPError(http.StatusBadRequest, "new name is the same as the current name")
+	}
+
+	results, err := h.repo.RenameTag(c.Request().Context(), tag, newTag, userName)
+	if err != nil {
+		return tagError(err)
+	}
+
+	return c.JSON(http.StatusOK, bulkResponse(results))
+}
+
+// POST /tags/:name/merge
+func (h *Handler) MergeTag(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	tag, err := tagParam(c)
+	if err != nil {
+		return err
+	}
+	var params mergeTagParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	into, err := validateTagName(params.Into)
+	if err != nil {
+		return err
+	}
+	if into == tag {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot merge a tag into itself")
+	}
+
+	results, err := h.repo.MergeTag(c.Request().Context(), tag, into, userName)
+	if err != nil {
+		return tagError(err)
+	}
+
+	return c.JSON(http.StatusOK, bulkResponse(results))
+}
+
+// GET /tags/:name/synonyms
+func (h *Handler) GetTagSynonyms(c echo.Context) error {
+	tag, err := tagParam(c)
+	if err != nil {
+		return err
+	}
+
+	synonyms, err := h.repo.GetTagSynonyms(c.Request().Context(), tag)
+	if err != nil {
+		return tagError(err)
+	}
+
+	return c.JSON(http.StatusOK, TagSynonymsResponse{Tag: tag, Synonyms: synonyms})
+}
+
+// PUT /tags/:name/synonyms
+func (h *Handler) SetTagSynonyms(c echo.Context) error {
+	if getUserName(c) == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	tag, err := tagParam(c)
+	if err != nil {
+		return err
+	}
+	var params tagSynonymsParams
+	if err := c.Bind(&params); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	synonyms := make([]string, 0, len(params.Synonyms))
+	for _, synonym := range params.Synonyms {
+		synonym, err := validateTagName(synonym)
+		if err != nil {
+			return err
+		}
+		synonyms = append(synonyms, synonym)
+	}
+
+	if err := h.repo.SetTagSynonyms(c.Request().Context(), tag, synonyms); err != nil {
+		return tagError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DELETE /tags/:name/synonyms
+func (h *Handler) DeleteTagSynonyms(c echo.Context) error {
+	if getUserName(c) == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	tag, err := tagParam(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.repo.DeleteTagSynonyms(c.Request().Context(), tag); err != nil {
+		return tagError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
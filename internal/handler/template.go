@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/traP-jp/circuledge-backend/internal/notetemplate"
+	"github.com/traP-jp/circuledge-backend/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// maxTemplateNameLength テンプレートの名前とタイトルの最大文字数
+	maxTemplateNameLength = 255
+	// maxTemplateBodySize テンプレートの本文の最大バイト数
+	maxTemplateBodySize = 65535
+)
+
+type (
+	templateParams struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+		Body  string `json:"body"`
+		// Channel 指定した場合はチャンネルのテンプレート，省略した場合は個人のテンプレートにする
+		Channel string `json:"channel"` // UUIDまたはチャンネルパス
+	}
+
+	GetTemplatesResponse struct {
+		Templates []repository.Template `json:"templates"`
+	}
+)
+
+// templateError リポジトリのエラーをHTTPのエラーに変換する
+func templateError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrTemplateNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "template not found")
+	case errors.Is(err, repository.ErrTemplateNotAvailable):
+		return echo.NewHTTPError(http.StatusBadRequest, "template is not available in the channel")
+	case errors.Is(err, notetemplate.ErrInvalidVariable), errors.Is(err, notetemplate.ErrUndefinedVariable):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, "permission denied")
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+}
+
+// bindTemplateParams リクエストボディを検証し，リポジトリに渡す形にする
+func (h *Handler) bindTemplateParams(c echo.Context) (repository.TemplateParams, error) {
+	var params templateParams
+	if err := c.Bind(&params); err != nil {
+		return repository.TemplateParams{}, echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	if strings.TrimSpace(params.Name) == "" {
+		return repository.TemplateParams{}, echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	if utf8.RuneCountInString(params.Name) > maxTemplateNameLength || utf8.RuneCountInString(params.Title) > maxTemplateNameLength {
+		return repository.TemplateParams{}, echo.NewHTTPError(http.StatusBadRequest, "name or title is too long")
+	}
+	if len(params.Body) > maxTemplateBodySize {
+		return repository.TemplateParams{}, echo.NewHTTPError(http.StatusBadRequest, "body is too long")
+	}
+	channelID, err := h.resolveChannel(c, params.Channel)
+	if err != nil {
+		return repository.TemplateParams{}, err
+	}
+
+	return repository.TemplateParams{
+		Name:    strings.TrimSpace(params.Name),
+		Title:   params.Title,
+		Body:    params.Body,
+		Channel: channelID,
+	}, nil
+}
+
+// GET /templates
+// channelを指定した場合，チャンネルのテンプレートはそのチャンネルで使えるものに絞り込む
+func (h *Handler) GetTemplates(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	channelID, err := h.resolveChannel(c, c.QueryParam("channel"))
+	if err != nil {
+		return err
+	}
+
+	templates, err := h.repo.GetTemplates(c.Request().Context(), userName, channelID)
+	if err != nil {
+		return templateError(err)
+	}
+
+	return c.JSON(http.StatusOK, GetTemplatesResponse{Templates: templates})
+}
+
+// POST /templates
+func (h *Handler) CreateTemplate(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	params, err := h.bindTemplateParams(c)
+	if err != nil {
+		return err
+	}
+
+	template, err := h.repo.CreateTemplate(c.Request().Context(), userName, params)
+	if err != nil {
+		return templateError(err)
+	}
+
+	return c.JSON(http.StatusCreated, template)
+}
+
+// GET /templates/:templateId
+func (h *Handler) GetTemplate(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+
+	template, err := h.repo.GetTemplate(c.Request().Context(), c.Param("templateId"), userName)
+	if err != nil {
+		return templateError(err)
+	}
+
+	return c.JSON(http.StatusOK, template)
+}
+
+// PUT /templates/:templateId
+func (h *Handler) UpdateTemplate(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	params, err := h.bindTemplateParams(c)
+	if err != nil {
+		return err
+	}
+
+	template, err := h.repo.UpdateTemplate(c.Request().Context(), c.Param("templateId"), userName, params)
+	if err != nil {
+		return templateError(err)
+	}
+
+	return c.JSON(http.StatusOK, template)
+}
+
+// DELETE /templates/:templateId
+func (h *Handler) DeleteTemplate(c echo.Context) error {
+	userName := getUserName(c)
+	if userName == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "login required")
+	}
+	if err := h.repo.DeleteTemplate(c.Request().Context(), c.Param("templateId"), userName); err != nil {
+		return templateError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
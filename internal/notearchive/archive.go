@@ -0,0 +1,211 @@
+// Package notearchive ノートをMarkdownファイルのzipアーカイブとして書き出す
+package notearchive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"gopkg.in/yaml.v3"
+)
+
+// maxFileNameLength ファイル名（拡張子を除く）の最大文字数
+const maxFileNameLength = 100
+
+type (
+	Note struct {
+		ID          string
+		Channel     string
+		ChannelPath string
+		Permission  string
+		Title       string
+		Body        string
+		Tags        []string
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+		// Revisions 古い順のリビジョン．空の場合は履歴を書き出さない
+		Revisions []Revision
+	}
+
+	Revision struct {
+		ID          string
+		Channel     string
+		ChannelPath string
+		Permission  string
+		Title       string
+		Body        string
+		UpdatedAt   time.Time
+	}
+)
+
+// frontMatter 書き出すファイルのfront matter
+// 本文にもともと書かれていたキーはExtraとして残す
+type frontMatter struct {
+	ID         string         `yaml:"id"`
+	Revision   string         `yaml:"revision,omitempty"`
+	Title      string         `yaml:"title"`
+	Channel    string         `yaml:"channel"`
+	Tags       []string       `yaml:"tags"`
+	Permission string         `yaml:"permission"`
+	CreatedAt  *time.Time     `yaml:"createdAt,omitempty"`
+	UpdatedAt  time.Time      `yaml:"updatedAt"`
+	Extra      map[string]any `yaml:",inline"`
+}
+
+// Writer ノートを1つずつzipアーカイブに書き込む
+type Writer struct {
+	zw    *zip.Writer
+	names map[string]struct{}
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		zw:    zip.NewWriter(w),
+		names: map[string]struct{}{},
+	}
+}
+
+// Add ノートを`<タイトル>.md`として書き込む
+// リビジョンがある場合は`<タイトル>.history/`以下にリビジョンごとのファイルを書き込む
+func (w *Writer) Add(note Note) error {
+	name := w.uniqueName(FileName(note.Title))
+
+	createdAt := note.CreatedAt
+	content, err := render(frontMatter{
+		ID:         note.ID,
+		Title:      note.Title,
+		Channel:    channelLabel(note.ChannelPath, note.Channel),
+		Tags:       note.Tags,
+		Permission: note.Permission,
+		CreatedAt:  &createdAt,
+		UpdatedAt:  note.UpdatedAt,
+	}, note.Body)
+	if err != nil {
+		return fmt.Errorf("render note %s: %w", note.ID, err)
+	}
+	if err := w.writeFile(name+".md", note.UpdatedAt, content); err != nil {
+		return err
+	}
+
+	for _, rev := range note.Revisions {
+		content, err := render(frontMatter{
+			ID:         note.ID,
+			Revision:   rev.ID,
+			Title:      rev.Title,
+			Channel:    channelLabel(rev.ChannelPath, rev.Channel),
+			Permission: rev.Permission,
+			UpdatedAt:  rev.UpdatedAt,
+		}, rev.Body)
+		if err != nil {
+			return fmt.Errorf("render revision %s: %w", rev.ID, err)
+		}
+		path := fmt.Sprintf("%s.history/%s_%s.md", name, rev.UpdatedAt.UTC().Format("20060102T150405Z"), rev.ID)
+		if err := w.writeFile(path, rev.UpdatedAt, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close zipアーカイブの末尾を書き込む．元のio.Writerは閉じない
+func (w *Writer) Close() error {
+	if err := w.zw.Close(); err != nil {
+		return fmt.Errorf("close zip archive: %w", err)
+	}
+
+	return nil
+}
+
+func (w *Writer) writeFile(path string, modified time.Time, content []byte) error {
+	f, err := w.zw.CreateHeader(&zip.FileHeader{
+		Name:     path,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return fmt.Errorf("create %s in zip archive: %w", path, err)
+	}
+	if _, err := f.Write(content); err != nil {
+		return fmt.Errorf("write %s to zip archive: %w", path, err)
+	}
+
+	return nil
+}
+
+// uniqueName 同じタイトルのノートがある場合は` (2)`のような番号を付けて区別する
+func (w *Writer) uniqueName(name string) string {
+	candidate := name
+	for i := 2; ; i++ {
+		key := strings.ToLower(candidate)
+		if _, ok := w.names[key]; !ok {
+			w.names[key] = struct{}{}
+
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+}
+
+// FileName タイトルをファイル名として使える文字列に変換する
+// パス区切りやWindowsで使えない文字は`_`に置き換える
+func FileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = strings.TrimSpace(string(runes[:maxFileNameLength]))
+	}
+	if name == "" {
+		return "untitled"
+	}
+
+	return name
+}
+
+func channelLabel(path string, id string) string {
+	if path == "" {
+		return id
+	}
+
+	return "#" + path
+}
+
+// render front matterを付けた本文を返す
+// 本文にもともとfront matterがある場合は，書き出す項目以外のキーを引き継いで1つにまとめる
+func render(meta frontMatter, body string) ([]byte, error) {
+	if existing, rest, err := notebody.SplitFrontMatter(body); err == nil && existing != nil {
+		for _, key := range []string{"id", "revision", "title", "channel", "tags", "permission", "createdAt", "updatedAt"} {
+			delete(existing, key)
+		}
+		meta.Extra = existing
+		body = rest
+	}
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+
+	out, err := yaml.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("marshal front matter: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	b.Write(out)
+	b.WriteString("---\n")
+	b.WriteString(body)
+
+	return []byte(b.String()), nil
+}
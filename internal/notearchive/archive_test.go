@@ -0,0 +1,96 @@
+package notearchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"議事録 2024/04/01": "議事録 2024_04_01",
+		"a:b*c?":         "a_b_c_",
+		"  ..hidden.. ":  "hidden",
+		"":               "untitled",
+		"\t\n":           "untitled",
+		"line\nbreak":    "linebreak",
+	}
+	for title, want := range tests {
+		if got := FileName(title); got != want {
+			t.Errorf("FileName(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	updatedAt := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	notes := []Note{
+		{
+			ID:          "note-1",
+			Channel:     "channel-1",
+			ChannelPath: "event/hackathon",
+			Permission:  "public",
+			Title:       "議事録",
+			Body:        "---\ntitle: old\nlang: ja\n---\n# 議事録\n",
+			Tags:        []string{"meeting"},
+			CreatedAt:   updatedAt.Add(-time.Hour),
+			UpdatedAt:   updatedAt,
+			Revisions: []Revision{
+				{ID: "rev-1", Channel: "channel-1", Permission: "limited", Title: "議事録", Body: "# 下書き\n", UpdatedAt: updatedAt.Add(-time.Hour)},
+			},
+		},
+		{ID: "note-2", Channel: "channel-2", Permission: "limited", Title: "議事録", UpdatedAt: updatedAt},
+	}
+	for _, note := range notes {
+		if err := w.Add(note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	names := []string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(b)
+		names = append(names, f.Name)
+	}
+
+	wantNames := []string{"議事録.md", "議事録.history/20240401T110000Z_rev-1.md", "議事録 (2).md"}
+	if !slices.Equal(names, wantNames) {
+		t.Fatalf("names = %v, want %v", names, wantNames)
+	}
+
+	first := files["議事録.md"]
+	for _, want := range []string{"id: note-1\n", "channel: '#event/hackathon'\n", "- meeting\n", "permission: public\n", "lang: ja\n", "updatedAt: 2024-04-01T12:00:00Z\n"} {
+		if !strings.Contains(first, want) {
+			t.Errorf("front matter does not contain %q:\n%s", want, first)
+		}
+	}
+	if strings.Contains(first, "title: old") || strings.Count(first, "---\n") != 2 {
+		t.Errorf("existing front matter is not merged:\n%s", first)
+	}
+	if !strings.HasSuffix(first, "---\n# 議事録\n") {
+		t.Errorf("body is not kept:\n%s", first)
+	}
+	if history := files["議事録.history/20240401T110000Z_rev-1.md"]; !strings.Contains(history, "revision: rev-1\n") || !strings.Contains(history, "channel: channel-1\n") {
+		t.Errorf("unexpected revision file:\n%s", history)
+	}
+}
@@ -0,0 +1,88 @@
+package notebody
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// codeParser コードの範囲を調べるためのMarkdownのパーサー
+var codeParser = goldmark.DefaultParser()
+
+// forEachText コードブロック（```・~~~・インデント）とインラインコードの外の部分をfnで書き換える
+func forEachText(body string, fn func(text string) string) string {
+	var b strings.Builder
+	pos := 0
+	for _, code := range codeSegments(body, true) {
+		if code.Start < pos {
+			continue
+		}
+		b.WriteString(fn(body[pos:code.Start]))
+		b.WriteString(body[code.Start:code.Stop])
+		pos = code.Stop
+	}
+	b.WriteString(fn(body[pos:]))
+
+	return b.String()
+}
+
+// forEachTextLine コードブロック（```・~~~・インデント）の外の各行をfnで書き換える
+// インラインコードを含む行も書き換えの対象にする
+func forEachTextLine(body string, fn func(line string) string) string {
+	codes := codeSegments(body, false)
+	lines := strings.Split(body, "\n")
+	start := 0
+	for i, line := range lines {
+		stop := start + len(line)
+		inCode := slices.ContainsFunc(codes, func(code text.Segment) bool {
+			return code.Start <= stop && start < code.Stop
+		})
+		if !inCode {
+			lines[i] = fn(line)
+		}
+		start = stop + 1
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// codeSegments 本文中のコードの中身の範囲を先頭から順に返す．inlineがfalseの場合はコードブロックのみを返す
+func codeSegments(body string, inline bool) []text.Segment {
+	source := []byte(body)
+	doc := codeParser.Parse(text.NewReader(source))
+
+	segments := []text.Segment{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segments = append(segments, lines.At(i))
+			}
+
+			return ast.WalkSkipChildren, nil
+		case *ast.CodeSpan:
+			if !inline {
+				return ast.WalkSkipChildren, nil
+			}
+			for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+				if t, ok := c.(*ast.Text); ok {
+					segments = append(segments, t.Segment)
+				}
+			}
+
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return segments
+}
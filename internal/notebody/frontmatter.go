@@ -0,0 +1,91 @@
+package notebody
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SplitFrontMatter 本文先頭の`---`で囲まれたYAML front matterを取り出し，残りの本文と共に返す
+// front matterがない場合はnilのmapと元の本文を返す
+func SplitFrontMatter(body string) (map[string]any, string, error) {
+	normalized := strings.ReplaceAll(body, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, "---\n") {
+		return nil, body, nil
+	}
+
+	rest := normalized[len("---\n"):]
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return nil, body, nil
+	}
+	afterEnd := rest[end+len("\n---"):]
+	if afterEnd != "" && afterEnd[0] != '\n' {
+		return nil, body, nil
+	}
+
+	meta := map[string]any{}
+	if err := yaml.Unmarshal([]byte(rest[:end]), &meta); err != nil {
+		return nil, body, fmt.Errorf("parse front matter: %w", err)
+	}
+
+	return meta, strings.TrimPrefix(afterEnd, "\n"), nil
+}
+
+// hackmdTagsPattern HackMDのタグ行（例：###### tags: `a` `b`）
+var hackmdTagsPattern = regexp.MustCompile("(?m)^#{1,6}\\s*tags\\s*:(.*)$")
+
+// FrontMatterTags front matterの`tags`をタグの一覧として返す
+// HackMDと同様に，リストのほかカンマ区切りの文字列も受け付ける
+func FrontMatterTags(meta map[string]any) []string {
+	tags := []string{}
+	switch v := meta["tags"].(type) {
+	case string:
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	case []any:
+		for _, tag := range v {
+			if s := strings.TrimSpace(fmt.Sprint(tag)); s != "" {
+				tags = append(tags, s)
+			}
+		}
+	}
+
+	return tags
+}
+
+// HackMDTags 本文中のHackMD形式のタグ行からタグを取り出す
+func HackMDTags(body string) []string {
+	tags := []string{}
+	for _, m := range hackmdTagsPattern.FindAllStringSubmatch(body, -1) {
+		tags = append(tags, ParseTagLine(m[1])...)
+	}
+
+	return tags
+}
+
+// ParseTagLine タグ行の`tags:`より後ろをタグの一覧として返す
+// `a` `b`のようにバッククォートで囲まれている場合はその中身を，そうでなければカンマや空白で区切ったものをタグとする
+func ParseTagLine(line string) []string {
+	tags := []string{}
+	if strings.Contains(line, "`") {
+		parts := strings.Split(line, "`")
+		for i := 1; i < len(parts); i += 2 {
+			if tag := strings.TrimSpace(parts[i]); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+
+		return tags
+	}
+	for _, tag := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
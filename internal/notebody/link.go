@@ -0,0 +1,65 @@
+package notebody
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Link 本文中の他のノートへのリンク
+type Link struct {
+	// Title `[[タイトル]]`の形式で書かれた場合のリンク先のタイトル
+	Title string
+	// NoteID `/notes/<uuid>`の形式で書かれた場合のリンク先のノートID
+	NoteID string
+	// Raw 本文中での表記
+	Raw string
+}
+
+var (
+	// wikiLinkPattern `[[タイトル]]`または`[[タイトル|表示名]]`
+	wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|\n]+)(\|[^\[\]\n]*)?\]\]`)
+	noteURLPattern  = regexp.MustCompile(`/notes/([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})`)
+)
+
+// ExtractLinks 本文中の`[[タイトル]]`と`/notes/<uuid>`を含むURLを他のノートへのリンクとして取り出す
+// コードブロック・インラインコード内は抽出の対象にしない
+func ExtractLinks(body string) []Link {
+	links := []Link{}
+	seen := map[Link]bool{}
+	add := func(link Link) {
+		if seen[link] {
+			return
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+
+	forEachText(body, func(text string) string {
+		for _, m := range wikiLinkPattern.FindAllStringSubmatch(text, -1) {
+			if title := strings.TrimSpace(m[1]); title != "" {
+				add(Link{Title: title, Raw: "[[" + title + "]]"})
+			}
+		}
+		for _, m := range noteURLPattern.FindAllStringSubmatch(text, -1) {
+			add(Link{NoteID: strings.ToLower(m[1]), Raw: m[0]})
+		}
+
+		return text
+	})
+
+	return links
+}
+
+// RetitleWikiLinks 本文中の`[[oldTitle]]`を`[[newTitle]]`に書き換える．表示名は保つ
+func RetitleWikiLinks(body string, oldTitle string, newTitle string) string {
+	return forEachText(body, func(text string) string {
+		return wikiLinkPattern.ReplaceAllStringFunc(text, func(s string) string {
+			m := wikiLinkPattern.FindStringSubmatch(s)
+			if strings.TrimSpace(m[1]) != oldTitle {
+				return s
+			}
+
+			return "[[" + newTitle + m[2] + "]]"
+		})
+	})
+}
@@ -0,0 +1,30 @@
+package notebody
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	body := "[[議事録]]と[[ 議事録 |先週の]]と[[設計]]\n" +
+		"[前回](https://circuledge.trap.show/notes/0197882D-208B-7C5A-BF60-89EAFB904106)\n" +
+		"`[[インライン]]`\n" +
+		"~~~\n[[コード]]\n~~~\n" +
+		"```\n[[コード]]\n```"
+	want := []Link{
+		{Title: "議事録", Raw: "[[議事録]]"},
+		{Title: "設計", Raw: "[[設計]]"},
+		{NoteID: "0197882d-208b-7c5a-bf60-89eafb904106", Raw: "/notes/0197882D-208B-7C5A-BF60-89EAFB904106"},
+	}
+	if got := ExtractLinks(body); !slices.Equal(got, want) {
+		t.Errorf("ExtractLinks() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRetitleWikiLinks(t *testing.T) {
+	body := "[[議事録]]と[[議事録|先週の]]と[[議事録2]]\n```\n[[議事録]]\n```"
+	want := "[[会議メモ]]と[[会議メモ|先週の]]と[[議事録2]]\n```\n[[議事録]]\n```"
+	if got := RetitleWikiLinks(body, "議事録", "会議メモ"); got != want {
+		t.Errorf("RetitleWikiLinks() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package notebody
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// 本文中で参照されるtraQのリソースの種類
+const (
+	ReferenceUser    = "user"
+	ReferenceGroup   = "group"
+	ReferenceChannel = "channel"
+	ReferenceMessage = "message"
+	ReferenceFile    = "file"
+)
+
+// referenceTypes 参照として扱う埋め込みの種類．traQが新しい種類を追加しても，それ以外は展開しない
+var referenceTypes = []string{ReferenceUser, ReferenceGroup, ReferenceChannel, ReferenceMessage, ReferenceFile}
+
+// Reference 本文中のtraQのユーザー・チャンネルなどへの参照
+type Reference struct {
+	Type string `json:"type"`
+	// ID 参照先のUUID．`@name`のように書かれていてIDが分からない場合は空
+	ID string `json:"id,omitempty"`
+	// Raw 本文中での表記（`@name`や`#path`）
+	Raw string `json:"raw"`
+}
+
+// traQの埋め込み記法 `!{"type":"user","raw":"@name","id":"..."}`
+type embed struct {
+	Type string `json:"type"`
+	Raw  string `json:"raw"`
+	ID   string `json:"id"`
+}
+
+var (
+	embedPattern   = regexp.MustCompile(`!\{[^{}\n]*\}`)
+	mentionPattern = regexp.MustCompile(`(^|[^\w@/])@([A-Za-z0-9_-]{1,32})`)
+	channelPattern = regexp.MustCompile(`(^|\s)#([\w\-]+(?:/[\w\-]+)*)`)
+)
+
+// ChannelResolver チャンネルパスからチャンネルのUUIDを引く
+type ChannelResolver func(path string) (string, bool)
+
+// ExtractReferences 本文中のtraQの埋め込みとメンション・チャンネル参照を取り出す
+// コード内と，種類が分からない埋め込みは抽出の対象にしない
+// resolveChannelがnilの場合，`#path`形式のチャンネル参照は抽出しない
+func ExtractReferences(body string, resolveChannel ChannelResolver) []Reference {
+	refs := []Reference{}
+	seen := map[Reference]bool{}
+	add := func(ref Reference) {
+		if seen[ref] {
+			return
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+
+	forEachText(body, func(text string) string {
+		// 埋め込みを表記に置き換えてから探し，埋め込みの表記が下のメンション・チャンネル参照として二重に数えられないようにする
+		embedded := map[string]bool{}
+		expanded := expandEmbeds(text, func(e embed) {
+			add(Reference{Type: e.Type, ID: e.ID, Raw: e.Raw})
+			embedded[e.Raw] = true
+		})
+
+		for _, m := range mentionPattern.FindAllStringSubmatch(expanded, -1) {
+			raw := "@" + m[2]
+			if !embedded[raw] {
+				add(Reference{Type: ReferenceUser, Raw: raw})
+			}
+		}
+		if resolveChannel == nil {
+			return text
+		}
+		for _, m := range channelPattern.FindAllStringSubmatch(expanded, -1) {
+			raw := "#" + m[2]
+			if embedded[raw] {
+				continue
+			}
+			if id, ok := resolveChannel(m[2]); ok {
+				add(Reference{Type: ReferenceChannel, ID: id, Raw: raw})
+			}
+		}
+
+		return text
+	})
+
+	return refs
+}
+
+// ExpandEmbeds traQの埋め込み記法を表記どおりのテキストに展開する．表示や検索用のテキストを作るときに使う
+// 保存する本文は埋め込みのIDを失わないよう展開しない．コード内と種類が分からない埋め込みはそのまま残す
+func ExpandEmbeds(body string) string {
+	return forEachText(body, func(text string) string {
+		return expandEmbeds(text, func(embed) {})
+	})
+}
+
+// expandEmbeds text中の参照として扱う埋め込みを表記に置き換え，置き換えた埋め込みごとにfoundを呼ぶ
+func expandEmbeds(text string, found func(e embed)) string {
+	return embedPattern.ReplaceAllStringFunc(text, func(s string) string {
+		var e embed
+		if err := json.Unmarshal([]byte(s[1:]), &e); err != nil || !slices.Contains(referenceTypes, e.Type) || e.Raw == "" {
+			return s
+		}
+		found(e)
+
+		return e.Raw
+	})
+}
+
+// MentionedUsers 参照のうちユーザーへのメンションのユーザー名を返す
+func MentionedUsers(refs []Reference) []string {
+	users := []string{}
+	for _, ref := range refs {
+		if ref.Type == ReferenceUser {
+			users = append(users, strings.TrimPrefix(ref.Raw, "@"))
+		}
+	}
+
+	return users
+}
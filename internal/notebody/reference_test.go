@@ -0,0 +1,62 @@
+package notebody
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractReferences(t *testing.T) {
+	channels := map[string]string{"event/hackathon": "0197882d-208b-7c5a-bf60-89eafb904106"}
+	resolve := func(path string) (string, bool) {
+		id, ok := channels[path]
+
+		return id, ok
+	}
+
+	body := "!{\"type\":\"user\",\"raw\":\"@toki\",\"id\":\"0197882d-208b-7c5a-bf60-89eafb904107\"} さんと @ras で #event/hackathon に参加\n" +
+		"#tag と mail@example.com と `@inline`\n" +
+		"```\n@code\n```\n" +
+		"~~~\n@tilde\n~~~\n" +
+		"\n    @indented\n"
+	refs := ExtractReferences(body, resolve)
+
+	wantRefs := []Reference{
+		{Type: ReferenceUser, ID: "0197882d-208b-7c5a-bf60-89eafb904107", Raw: "@toki"},
+		{Type: ReferenceUser, Raw: "@ras"},
+		{Type: ReferenceChannel, ID: "0197882d-208b-7c5a-bf60-89eafb904106", Raw: "#event/hackathon"},
+	}
+	if !slices.Equal(refs, wantRefs) {
+		t.Errorf("refs = %+v, want %+v", refs, wantRefs)
+	}
+	if users := MentionedUsers(refs); !slices.Equal(users, []string{"toki", "ras"}) {
+		t.Errorf("MentionedUsers() = %v", users)
+	}
+}
+
+func TestExtractReferencesUnknownEmbed(t *testing.T) {
+	body := "!{\"type\":\"stamp\",\"raw\":\":wave:\",\"id\":\"0197882d-208b-7c5a-bf60-89eafb904108\"} と !{\"type\":\"group\",\"raw\":\"@sysad\",\"id\":\"0197882d-208b-7c5a-bf60-89eafb904109\"}"
+	refs := ExtractReferences(body, nil)
+
+	wantRefs := []Reference{
+		{Type: ReferenceGroup, ID: "0197882d-208b-7c5a-bf60-89eafb904109", Raw: "@sysad"},
+	}
+	if !slices.Equal(refs, wantRefs) {
+		t.Errorf("refs = %+v, want %+v", refs, wantRefs)
+	}
+}
+
+func TestExpandEmbeds(t *testing.T) {
+	embed := "!{\"type\":\"group\",\"raw\":\"@sysad\",\"id\":\"0197882d-208b-7c5a-bf60-89eafb904109\"}"
+	stamp := "!{\"type\":\"stamp\",\"raw\":\":wave:\",\"id\":\"0197882d-208b-7c5a-bf60-89eafb904108\"}"
+	body := embed + " と " + stamp + "\n~~~\n" + embed + "\n~~~"
+
+	want := "@sysad と " + stamp + "\n~~~\n" + embed + "\n~~~"
+	if got := ExpandEmbeds(body); got != want {
+		t.Errorf("ExpandEmbeds() = %q, want %q", got, want)
+	}
+	// 保存した本文から抽出し直しても，グループへの参照がユーザーへのメンションにならない
+	refs := ExtractReferences(body, nil)
+	if users := MentionedUsers(refs); len(users) != 0 {
+		t.Errorf("MentionedUsers() = %v, want none", users)
+	}
+}
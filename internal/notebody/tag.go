@@ -0,0 +1,111 @@
+package notebody
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RenameTag 本文中のfront matterの`tags`とHackMD形式のタグ行にあるタグoldTagをnewTagに書き換える
+// newTagが既にある場合はoldTagを取り除く．コードブロック内は書き換えない
+func RenameTag(body string, oldTag string, newTag string) string {
+	body = renameFrontMatterTag(body, oldTag, newTag)
+
+	return forEachTextLine(body, func(line string) string {
+		m := hackmdTagsPattern.FindStringSubmatchIndex(line)
+		if m == nil {
+			return line
+		}
+		tags := ParseTagLine(line[m[2]:m[3]])
+		renamed, ok := renameTags(tags, oldTag, newTag)
+		if !ok {
+			return line
+		}
+
+		if strings.Contains(line[m[2]:m[3]], "`") {
+			for i, tag := range renamed {
+				renamed[i] = "`" + tag + "`"
+			}
+
+			return line[:m[2]] + " " + strings.Join(renamed, " ")
+		}
+
+		return line[:m[2]] + " " + strings.Join(renamed, ", ")
+	})
+}
+
+// renameTags タグの一覧のoldTagをnewTagに置き換える．oldTagがなければfalseを返す
+func renameTags(tags []string, oldTag string, newTag string) ([]string, bool) {
+	if !slices.Contains(tags, oldTag) {
+		return tags, false
+	}
+
+	renamed := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == oldTag {
+			tag = newTag
+		}
+		if !slices.Contains(renamed, tag) {
+			renamed = append(renamed, tag)
+		}
+	}
+
+	return renamed, true
+}
+
+// renameFrontMatterTag front matterの`tags`のタグを書き換える
+// 書き換えが必要な場合のみfront matterをYAMLとして書き出し直す
+func renameFrontMatterTag(body string, oldTag string, newTag string) string {
+	meta, rest, err := SplitFrontMatter(body)
+	if err != nil || meta == nil {
+		return body
+	}
+	if _, ok := renameTags(FrontMatterTags(meta), oldTag, newTag); !ok {
+		return body
+	}
+
+	normalized := strings.ReplaceAll(body, "\r\n", "\n")
+	raw := normalized[len("---\n") : len("---\n")+strings.Index(normalized[len("---\n"):], "\n---")]
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(raw), &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return body
+	}
+
+	mapping := doc.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != "tags" {
+			continue
+		}
+		value := mapping.Content[i+1]
+		switch value.Kind {
+		case yaml.ScalarNode:
+			renamed, _ := renameTags(FrontMatterTags(meta), oldTag, newTag)
+			value.Value = strings.Join(renamed, ", ")
+		case yaml.SequenceNode:
+			items := []*yaml.Node{}
+			seen := map[string]bool{}
+			for _, item := range value.Content {
+				if strings.TrimSpace(item.Value) == oldTag {
+					item.Value = newTag
+				}
+				if seen[item.Value] {
+					continue
+				}
+				seen[item.Value] = true
+				items = append(items, item)
+			}
+			value.Content = items
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return body
+	}
+
+	return "---\n" + buf.String() + "---\n" + rest
+}
@@ -0,0 +1,42 @@
+package notebody
+
+import "testing"
+
+func TestRenameTag(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "hackmd tag line",
+			body: "# 議事録\n###### tags: `hackathon` `25spring`\n",
+			want: "# 議事録\n###### tags: `ハッカソン` `25spring`\n",
+		},
+		{
+			name: "comma separated tag line",
+			body: "###### tags: hackathon, ハッカソン",
+			want: "###### tags: ハッカソン",
+		},
+		{
+			name: "front matter list",
+			body: "---\ntitle: 議事録\ntags:\n  - hackathon\n  - 25spring\n---\n本文",
+			want: "---\ntitle: 議事録\ntags:\n  - ハッカソン\n  - 25spring\n---\n本文",
+		},
+		{
+			name: "front matter string",
+			body: "---\ntags: hackathon, 25spring\n---\n本文",
+			want: "---\ntags: ハッカソン, 25spring\n---\n本文",
+		},
+		{
+			name: "code block and other tags",
+			body: "###### tags: `hackathon2`\n```\n###### tags: `hackathon`\n```",
+			want: "###### tags: `hackathon2`\n```\n###### tags: `hackathon`\n```",
+		},
+	}
+	for _, tt := range tests {
+		if got := RenameTag(tt.body, "hackathon", "ハッカソン"); got != tt.want {
+			t.Errorf("%s: RenameTag() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
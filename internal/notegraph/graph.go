@@ -0,0 +1,79 @@
+// Package notegraph ノート・タグ・チャンネルの関係をグラフとして表し，GraphMLやDOTに書き出す
+package notegraph
+
+type (
+	NodeType string
+	EdgeType string
+)
+
+const (
+	NodeNote    NodeType = "note"
+	NodeTag     NodeType = "tag"
+	NodeChannel NodeType = "channel"
+
+	// EdgeLink ノートの本文中のリンク
+	EdgeLink EdgeType = "link"
+	// EdgeTag ノートからタグへ
+	EdgeTag EdgeType = "tag"
+	// EdgeChannel ノートから所属するチャンネルへ
+	EdgeChannel EdgeType = "channel"
+)
+
+type Node struct {
+	// ID 種類ごとの接頭辞を付けたID（`note:<uuid>`，`tag:<名前>`，`channel:<uuid>`）
+	ID    string   `json:"id"`
+	Type  NodeType `json:"type"`
+	Label string   `json:"label"`
+}
+
+type Edge struct {
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	Type   EdgeType `json:"type"`
+}
+
+// Graph 追加した順にノードと辺を保持する．同じノードと辺は1度だけ追加される
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+
+	nodes map[string]bool
+	edges map[Edge]bool
+}
+
+func New() *Graph {
+	return &Graph{
+		Nodes: []Node{},
+		Edges: []Edge{},
+		nodes: map[string]bool{},
+		edges: map[Edge]bool{},
+	}
+}
+
+func NoteID(id string) string    { return string(NodeNote) + ":" + id }
+func TagID(name string) string   { return string(NodeTag) + ":" + name }
+func ChannelID(id string) string { return string(NodeChannel) + ":" + id }
+
+// AddNode ノードを追加し，そのIDを返す
+func (g *Graph) AddNode(node Node) string {
+	if !g.nodes[node.ID] {
+		g.nodes[node.ID] = true
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	return node.ID
+}
+
+// HasNode ノードが追加済みかどうか
+func (g *Graph) HasNode(id string) bool {
+	return g.nodes[id]
+}
+
+// AddEdge 辺を追加する．両端のノードは先に追加しておく
+func (g *Graph) AddEdge(edge Edge) {
+	if g.edges[edge] {
+		return
+	}
+	g.edges[edge] = true
+	g.Edges = append(g.Edges, edge)
+}
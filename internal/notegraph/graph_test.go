@@ -0,0 +1,77 @@
+package notegraph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testGraph() *Graph {
+	g := New()
+	note := g.AddNode(Node{ID: NoteID("n1"), Type: NodeNote, Label: `議事録 "4月"`})
+	other := g.AddNode(Node{ID: NoteID("n2"), Type: NodeNote, Label: "設計"})
+	tag := g.AddNode(Node{ID: TagID("会議"), Type: NodeTag, Label: "会議"})
+	g.AddNode(Node{ID: TagID("会議"), Type: NodeTag, Label: "会議"})
+	channel := g.AddNode(Node{ID: ChannelID("c1"), Type: NodeChannel, Label: "#team/sysad"})
+	g.AddEdge(Edge{Source: note, Target: other, Type: EdgeLink})
+	g.AddEdge(Edge{Source: note, Target: tag, Type: EdgeTag})
+	g.AddEdge(Edge{Source: note, Target: tag, Type: EdgeTag})
+	g.AddEdge(Edge{Source: note, Target: channel, Type: EdgeChannel})
+
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	g := testGraph()
+	if len(g.Nodes) != 4 {
+		t.Errorf("len(Nodes) = %d, want 4", len(g.Nodes))
+	}
+	if len(g.Edges) != 3 {
+		t.Errorf("len(Edges) = %d, want 3", len(g.Edges))
+	}
+	if !g.HasNode(NoteID("n2")) || g.HasNode(NoteID("n3")) {
+		t.Error("HasNode() returned unexpected result")
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, testGraph()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `digraph notes {
+  "note:n1" [label="議事録 \"4月\"", shape=box];
+  "note:n2" [label="設計", shape=box];
+  "tag:会議" [label="会議", shape=ellipse];
+  "channel:c1" [label="#team/sysad", shape=folder];
+  "note:n1" -> "note:n2" [label="link"];
+  "note:n1" -> "tag:会議" [label="tag"];
+  "note:n1" -> "channel:c1" [label="channel"];
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteDOT() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGraphML(&buf, testGraph()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		`<graph id="notes" edgedefault="directed">`,
+		`<node id="note:n1">`,
+		`<data key="label">議事録 &#34;4月&#34;</data>`,
+		`<data key="type">channel</data>`,
+		`<edge source="note:n1" target="tag:会議">`,
+		`<data key="edgeType">link</data>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteGraphML() does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package noterender
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	kindMathInline = ast.NewNodeKind("MathInline")
+	kindMathBlock  = ast.NewNodeKind("MathBlock")
+	kindContainer  = ast.NewNodeKind("Container")
+	kindMermaid    = ast.NewNodeKind("Mermaid")
+)
+
+// hackmdExtension HackMDで使われる数式・`:::`コンテナ・mermaidの記法
+type hackmdExtension struct{}
+
+func (e *hackmdExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(
+			util.Prioritized(&containerParser{}, 750),
+			util.Prioritized(&mathBlockParser{}, 750),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(&mathInlineParser{}, 500),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&mermaidTransformer{}, 500),
+		),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&hackmdRenderer{}, 500),
+	))
+}
+
+// mathInline `$...$`で囲まれた数式
+type mathInline struct {
+	ast.BaseInline
+	value   []byte
+	display bool
+}
+
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Value": string(n.value)}, nil)
+}
+
+// mathBlock `$$`の行で囲まれた数式
+type mathBlock struct {
+	ast.BaseBlock
+	// closed 開始行で閉じられている
+	closed bool
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) IsRaw() bool { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// container `:::success`から`:::`までのブロック
+type container struct {
+	ast.BaseBlock
+	name  string
+	title string
+	// fence 開始行のコロンの数．これ以上のコロンだけの行で閉じる
+	fence int
+}
+
+func (n *container) Kind() ast.NodeKind { return kindContainer }
+
+func (n *container) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.name, "Title": n.title}, nil)
+}
+
+// mermaidBlock 言語にmermaidを指定したコードブロック
+type mermaidBlock struct {
+	ast.BaseBlock
+}
+
+func (n *mermaidBlock) Kind() ast.NodeKind { return kindMermaid }
+
+func (n *mermaidBlock) IsRaw() bool { return true }
+
+func (n *mermaidBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type mathInlineParser struct{}
+
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse `$5 と $10`のような金額を数式と見なさないよう，Pandocと同様に
+// 開始の`$`の直後と終了の`$`の直前が空白でなく，終了の`$`の直後が数字でない場合のみ数式とする
+func (p *mathInlineParser) Parse(_ ast.Node, block text.Reader, _ parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	start := delim
+	if start >= len(line) || util.IsSpace(line[start]) {
+		return nil
+	}
+
+	for i := start; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case line[i] == '$':
+			if !bytes.HasPrefix(line[i:], bytes.Repeat([]byte{'$'}, delim)) {
+				return nil
+			}
+			end := i
+			if util.IsSpace(line[end-1]) || end == start {
+				return nil
+			}
+			if next := end + delim; delim == 1 && next < len(line) && line[next] >= '0' && line[next] <= '9' {
+				return nil
+			}
+			block.Advance(end + delim)
+
+			return &mathInline{value: bytes.Clone(line[start:end]), display: delim == 2}
+		}
+	}
+
+	return nil
+}
+
+type mathBlockParser struct{}
+
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathBlockParser) Open(_ ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+
+	node := &mathBlock{}
+	rest := util.TrimRightSpace(line[pos+2:])
+	if bytes.HasSuffix(rest, []byte("$$")) {
+		// `$$x^2$$`のように1行で閉じている
+		if len(rest) == 2 {
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(segment.Start+pos+2, segment.Start+pos+len(rest)))
+		node.closed = true
+
+		return node, parser.NoChildren
+	}
+	if bytes.Contains(rest, []byte("$$")) {
+		// `$$x$$ y`は段落中の数式として扱う
+		return nil, parser.NoChildren
+	}
+	if !util.IsBlank(rest) {
+		node.Lines().Append(text.NewSegment(segment.Start+pos+2, segment.Stop))
+	}
+
+	return node, parser.NoChildren
+}
+
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, _ parser.Context) parser.State {
+	if node.(*mathBlock).closed {
+		return parser.Close
+	}
+
+	line, segment := reader.PeekLine()
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if content := trimmed[:len(trimmed)-2]; !util.IsBlank(content) {
+			node.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(content)))
+		}
+		reader.Advance(segment.Len() - trailingNewline(line))
+
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - trailingNewline(line))
+
+	return parser.Continue | parser.NoChildren
+}
+
+func (p *mathBlockParser) Close(ast.Node, text.Reader, parser.Context) {}
+
+func (p *mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (p *mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+// containerPattern `:::success`や`:::spoiler タイトル`のような開始行
+var containerPattern = regexp.MustCompile(`^(:{3,})\s*([A-Za-z][\w-]*)\s*(.*?)\s*$`)
+
+type containerParser struct{}
+
+func (p *containerParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (p *containerParser) Open(_ ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+	m := containerPattern.FindSubmatch(line[pos:])
+	if m == nil {
+		return nil, parser.NoChildren
+	}
+	// 開始行の残りを子ブロックとして解析しないように読み飛ばす
+	reader.Advance(segment.Len() - trailingNewline(line))
+
+	return &container{
+		name:  string(m[2]),
+		title: string(m[3]),
+		fence: len(m[1]),
+	}, parser.HasChildren
+}
+
+func (p *containerParser) Continue(node ast.Node, reader text.Reader, _ parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	trimmed := util.TrimRightSpace(util.TrimLeftSpace(line))
+	if len(trimmed) >= node.(*container).fence && len(bytes.Trim(trimmed, ":")) == 0 {
+		reader.Advance(segment.Len() - trailingNewline(line))
+
+		return parser.Close
+	}
+
+	return parser.Continue | parser.HasChildren
+}
+
+func (p *containerParser) Close(ast.Node, text.Reader, parser.Context) {}
+
+func (p *containerParser) CanInterruptParagraph() bool { return true }
+
+func (p *containerParser) CanAcceptIndentedLine() bool { return false }
+
+func trailingNewline(line []byte) int {
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		return 1
+	}
+
+	return 0
+}
+
+// mermaidTransformer mermaidのコードブロックを図として描画するノードに置き換える
+type mermaidTransformer struct{}
+
+func (t *mermaidTransformer) Transform(doc *ast.Document, reader text.Reader, _ parser.Context) {
+	blocks := []*ast.FencedCodeBlock{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.FencedCodeBlock); ok && entering && string(block.Language(reader.Source())) == "mermaid" {
+			blocks = append(blocks, block)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		node := &mermaidBlock{}
+		node.SetLines(block.Lines())
+		block.Parent().ReplaceChild(block.Parent(), block, node)
+	}
+}
+
+// hackmdRenderer 数式とmermaidはクライアント側で描画できるようにソースをそのまま出力する
+type hackmdRenderer struct{}
+
+func (r *hackmdRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMathInline, r.renderMathInline)
+	reg.Register(kindMathBlock, r.renderMathBlock)
+	reg.Register(kindContainer, r.renderContainer)
+	reg.Register(kindMermaid, r.renderMermaid)
+}
+
+func (r *hackmdRenderer) renderMathInline(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathInline)
+	if n.display {
+		_, _ = w.WriteString(`<span class="math display">\[`)
+		_, _ = w.Write(util.EscapeHTML(n.value))
+		_, _ = w.WriteString(`\]</span>`)
+	} else {
+		_, _ = w.WriteString(`<span class="math inline">\(`)
+		_, _ = w.Write(util.EscapeHTML(n.value))
+		_, _ = w.WriteString(`\)</span>`)
+	}
+
+	return ast.WalkContinue, nil
+}
+
+func (r *hackmdRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<div class="math display">\[`)
+	writeEscapedLines(w, source, node)
+	_, _ = w.WriteString("\\]</div>\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *hackmdRenderer) renderMermaid(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<pre class="mermaid">`)
+	writeEscapedLines(w, source, node)
+	_, _ = w.WriteString("</pre>\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+// renderContainer HackMDと同様に，spoilerは折りたたみ，それ以外は`alert-<name>`のクラスを付けたdivにする
+func (r *hackmdRenderer) renderContainer(w util.BufWriter, _ []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*container)
+	if n.name == "spoiler" {
+		if entering {
+			title := n.title
+			if title == "" {
+				title = "spoiler"
+			}
+			_, _ = w.WriteString("<details><summary>")
+			_, _ = w.Write(util.EscapeHTML([]byte(title)))
+			_, _ = w.WriteString("</summary>\n")
+		} else {
+			_, _ = w.WriteString("</details>\n")
+		}
+
+		return ast.WalkContinue, nil
+	}
+
+	if entering {
+		_, _ = w.WriteString(`<div class="alert alert-`)
+		_, _ = w.Write(util.EscapeHTML([]byte(n.name)))
+		_, _ = w.WriteString("\">\n")
+	} else {
+		_, _ = w.WriteString("</div>\n")
+	}
+
+	return ast.WalkContinue, nil
+}
+
+func writeEscapedLines(w util.BufWriter, source []byte, node ast.Node) {
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+	}
+}
@@ -0,0 +1,123 @@
+package noterender
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	// DefaultTitle 本文からタイトルを決められない場合のタイトル
+	DefaultTitle = "新規ノート"
+	// summaryLength 要約の最大文字数
+	summaryLength = 100
+)
+
+// Metadata 本文から導出したノートの情報
+type Metadata struct {
+	Title   string
+	Summary string
+	Tags    []string
+}
+
+// tagLinePattern 見出しとして書かれたHackMDのタグ行の中身
+var tagLinePattern = regexp.MustCompile(`^tags\s*:(.*)$`)
+
+// ExtractMetadata 本文からタイトル・要約・タグを導出する
+//
+//   - タイトル: front matterの`title`，なければ最初の見出し，それもなければ最初の段落の1行目
+//   - 要約: 先頭からの段落のテキストを最大100文字まで
+//   - タグ: front matterの`tags`とHackMD形式の`###### tags:`の行
+func ExtractMetadata(body string) Metadata {
+	meta, rest, err := notebody.SplitFrontMatter(body)
+	if err != nil {
+		meta, rest = nil, body
+	}
+	source := []byte(notebody.ExpandEmbeds(rest))
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	res := Metadata{Tags: notebody.FrontMatterTags(meta)}
+	if title, ok := meta["title"].(string); ok {
+		res.Title = strings.TrimSpace(title)
+	}
+
+	var summary []string
+	summaryRunes := 0
+	fallbackTitle := ""
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Heading:
+			if m := tagLinePattern.FindSubmatch(headingSource(n, source)); m != nil {
+				for _, tag := range notebody.ParseTagLine(string(m[1])) {
+					if !slices.Contains(res.Tags, tag) {
+						res.Tags = append(res.Tags, tag)
+					}
+				}
+
+				return ast.WalkSkipChildren, nil
+			}
+			if res.Title == "" {
+				res.Title = nodeText(n, source)
+			}
+
+			return ast.WalkSkipChildren, nil
+		case *ast.Paragraph:
+			if fallbackTitle == "" {
+				fallbackTitle, _, _ = strings.Cut(nodeText(n, source), "\n")
+			}
+			if summaryRunes >= summaryLength {
+				return ast.WalkSkipChildren, nil
+			}
+			paragraph := strings.Join(strings.Fields(nodeText(n, source)), " ")
+			if paragraph == "" {
+				return ast.WalkSkipChildren, nil
+			}
+			summary = append(summary, paragraph)
+			summaryRunes += len([]rune(paragraph))
+
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	res.Summary = truncateSummary(strings.Join(summary, " "))
+	if res.Title == "" {
+		res.Title = fallbackTitle
+	}
+	if res.Title == "" {
+		res.Title = DefaultTitle
+	}
+
+	return res
+}
+
+// headingSource 見出しの`#`を除いた元の記述
+func headingSource(n *ast.Heading, source []byte) []byte {
+	var raw []byte
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		raw = append(raw, line.Value(source)...)
+	}
+
+	return raw
+}
+
+// truncateSummary 要約の最大文字数を超える場合は省略記号を付ける
+func truncateSummary(s string) string {
+	runes := []rune(s)
+	if len(runes) <= summaryLength {
+		return s
+	}
+
+	return string(runes[:summaryLength]) + "..."
+}
@@ -0,0 +1,49 @@
+package noterender
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Metadata
+	}{
+		{
+			name: "heading",
+			body: "# 議事録 **4月**\n\n今日は`ハッカソン`の\n話をした。\n\n## 議題\n\n- 項目\n\n###### tags: `meeting` `2024`",
+			want: Metadata{Title: "議事録 4月", Summary: "今日はハッカソンの 話をした。", Tags: []string{"meeting", "2024"}},
+		},
+		{
+			name: "front matter",
+			body: "---\ntitle: 設定のタイトル\ntags: a, b\n---\n# 見出し\n\n本文 #c",
+			want: Metadata{Title: "設定のタイトル", Summary: "本文 #c", Tags: []string{"a", "b"}},
+		},
+		{
+			name: "no heading",
+			body: "1行目\n2行目\n\n```\n# コード\n```",
+			want: Metadata{Title: "1行目", Summary: "1行目 2行目", Tags: []string{}},
+		},
+		{
+			name: "empty",
+			body: "",
+			want: Metadata{Title: DefaultTitle, Summary: "", Tags: []string{}},
+		},
+		{
+			name: "long summary",
+			body: "# t\n\n" + strings.Repeat("あ", 80) + "\n\n" + strings.Repeat("い", 80) + "\n\n" + "う",
+			want: Metadata{Title: "t", Summary: strings.Repeat("あ", 80) + " " + strings.Repeat("い", 19) + "...", Tags: []string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractMetadata(tt.body)
+			if got.Title != tt.want.Title || got.Summary != tt.want.Summary || !slices.Equal(got.Tags, tt.want.Tags) {
+				t.Errorf("ExtractMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
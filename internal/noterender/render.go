@@ -0,0 +1,127 @@
+// Package noterender ノートの本文（Markdown）をHTMLや検索用のプレーンテキストに変換する
+//
+// CommonMarkにGFMの表・タスクリスト・打ち消し線・自動リンク，脚注，数式，mermaid，
+// HackMD形式の`:::`コンテナを加えた記法に対応する
+package noterender
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+		extension.Footnote,
+		&hackmdExtension{},
+	),
+	goldmark.WithRendererOptions(
+		html.WithHardWraps(),
+		// 本文中のHTMLはそのまま出力し，sanitizeで安全なものだけを残す
+		html.WithUnsafe(),
+	),
+)
+
+// policy 出力するHTMLに許可する要素と属性
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w\- ]+$`)).Globally()
+	p.AllowElements("details", "summary")
+	p.AllowAttrs("open").OnElements("details")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^fn(ref\d*)?:[\w\-]+$`)).OnElements("li", "sup", "a")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+
+	return p
+}()
+
+// Render 本文をHTMLに変換する．traQの埋め込みは表記どおりのテキストとして出力する
+// 出力はサニタイズ済みのため，そのままページに埋め込める
+func Render(body string) (string, error) {
+	source := []byte(notebody.ExpandEmbeds(stripFrontMatter(body)))
+	var buf bytes.Buffer
+	if err := markdown.Convert(source, &buf); err != nil {
+		return "", fmt.Errorf("render markdown: %w", err)
+	}
+
+	return policy.Sanitize(buf.String()), nil
+}
+
+// PlainText 本文から記法を取り除いたテキストを返す．検索用のインデックスに使う
+// ブロックごとに1行以上に分け，HTMLタグとmermaidの図は含めない．traQの埋め込みは表記に展開する
+func PlainText(body string) string {
+	source := []byte(notebody.ExpandEmbeds(stripFrontMatter(body)))
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	return nodeText(doc, source)
+}
+
+// nodeText ノード以下のテキストを取り出す
+func nodeText(node ast.Node, source []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString("\n")
+			}
+
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteString("\n")
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.AutoLink:
+			b.Write(n.Label(source))
+		case *ast.CodeBlock, *ast.FencedCodeBlock, *mathBlock:
+			writeLines(&b, n, source)
+
+			return ast.WalkSkipChildren, nil
+		case *mathInline:
+			b.Write(n.value)
+		case *ast.RawHTML, *ast.HTMLBlock, *mermaidBlock:
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return strings.TrimSpace(b.String())
+}
+
+func writeLines(b *strings.Builder, n ast.Node, source []byte) {
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		b.Write(line.Value(source))
+	}
+}
+
+// stripFrontMatter front matterは本文として表示しない
+func stripFrontMatter(body string) string {
+	meta, rest, err := notebody.SplitFrontMatter(body)
+	if err != nil || meta == nil {
+		return body
+	}
+
+	return rest
+}
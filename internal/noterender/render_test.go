@@ -0,0 +1,91 @@
+package noterender
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+		deny []string
+	}{
+		{
+			name: "table",
+			body: "| a | b |\n|:-|-:|\n| 1 | 2 |",
+			want: []string{"<table>", `<th align="left">a</th>`, `<td align="right">2</td>`},
+		},
+		{
+			name: "task list",
+			body: "- [x] done\n- [ ] todo",
+			want: []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`},
+		},
+		{
+			name: "footnote",
+			body: "本文[^1]\n\n[^1]: 脚注",
+			want: []string{`<a href="#fn:1"`, `<li id="fn:1"`, "脚注"},
+		},
+		{
+			name: "math",
+			body: "$E = mc^2$ と $5 と $10\n\n$$\n\\int_0^1 x\\,dx < 1\n$$",
+			want: []string{`<span class="math inline">\(E = mc^2\)</span>`, "$5 と $10", `<div class="math display">\[\int_0^1 x\,dx &lt; 1`},
+		},
+		{
+			name: "mermaid",
+			body: "```mermaid\ngraph TD\n  A-->B\n```",
+			want: []string{`<pre class="mermaid">graph TD`, "A--&gt;B"},
+			deny: []string{"<code"},
+		},
+		{
+			name: "container",
+			body: ":::success\n**成功**\n:::\n\n:::spoiler 答え\n42\n:::",
+			want: []string{`<div class="alert alert-success">`, "<strong>成功</strong>", "<details><summary>答え</summary>", "<p>42</p>"},
+		},
+		{
+			name: "nested container",
+			body: "::::info\n:::warning\n注意\n:::\n外側\n::::",
+			want: []string{`<div class="alert alert-info">` + "\n" + `<div class="alert alert-warning">` + "\n<p>注意</p>\n</div>\n<p>外側</p>\n</div>"},
+		},
+		{
+			name: "front matter",
+			body: "---\ntitle: タイトル\n---\n# 見出し",
+			want: []string{"<h1>見出し</h1>"},
+			deny: []string{"title:"},
+		},
+		{
+			name: "sanitize",
+			body: "<script>alert(1)</script>\n\n<a href=\"javascript:alert(1)\" onclick=\"x()\">link</a> <span style=\"color:red\">赤</span>",
+			want: []string{"link", "赤"},
+			deny: []string{"<script", "javascript:", "onclick", "style="},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output does not contain %q:\n%s", want, got)
+				}
+			}
+			for _, deny := range tt.deny {
+				if strings.Contains(got, deny) {
+					t.Errorf("output contains %q:\n%s", deny, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	body := "---\ntags: a\n---\n# 見出し\n\n**太字**と`code`と[リンク](https://example.com)と$x^2$\n\n" +
+		"<div>html</div>\n\n```mermaid\ngraph TD\n```\n\n- 項目1\n- 項目2"
+	want := "見出し\n太字とcodeとリンクとx^2\n項目1\n項目2"
+	if got := PlainText(body); got != want {
+		t.Errorf("PlainText() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+// Package notetemplate ノートのテンプレートの変数を展開する
+//
+// テンプレート中の`{{name}}`を変数の値に置き換える．組み込みの変数は次のとおり
+//
+//   - date: 作成日（2006-01-02の形式，日本時間）
+//   - time: 作成時刻（15:04の形式，日本時間）
+//   - channel: チャンネル名
+//   - channelPath: チャンネルのフルパス
+//   - author: 作成したユーザーのtraQ ID
+//   - number: テンプレートから作成するたびに1ずつ増える番号
+package notetemplate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NumberVariable テンプレートから作成するたびに増える番号の変数名
+const NumberVariable = "number"
+
+var (
+	ErrInvalidVariable   = errors.New("invalid template variable")
+	ErrUndefinedVariable = errors.New("undefined template variable")
+
+	variablePattern = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+	namePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+)
+
+// Context 組み込みの変数の値
+type Context struct {
+	Now         time.Time
+	ChannelPath string
+	Author      string
+	Number      int
+}
+
+// Variables 組み込みの変数を名前と値の組にする
+func (c Context) Variables() map[string]string {
+	now := c.Now.In(jst)
+	channel := c.ChannelPath
+	if i := strings.LastIndex(channel, "/"); i >= 0 {
+		channel = channel[i+1:]
+	}
+
+	return map[string]string{
+		"date":         now.Format("2006-01-02"),
+		"time":         now.Format("15:04"),
+		"channel":      channel,
+		"channelPath":  c.ChannelPath,
+		"author":       c.Author,
+		NumberVariable: strconv.Itoa(c.Number),
+	}
+}
+
+// IsBuiltin 組み込みの変数かどうか
+func IsBuiltin(name string) bool {
+	_, ok := Context{}.Variables()[name]
+
+	return ok
+}
+
+// Variables テンプレート中の変数名を出現順に重複なく返す
+// 変数名として使えない`{{...}}`があればErrInvalidVariableを返す
+func Variables(src string) ([]string, error) {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, m := range variablePattern.FindAllStringSubmatch(src, -1) {
+		name := strings.TrimSpace(m[1])
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidVariable, m[0])
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// Uses テンプレートが変数nameを使っているかどうか
+func Uses(src string, name string) bool {
+	names, err := Variables(src)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(names, name)
+}
+
+// Render テンプレート中の変数をvarsの値に置き換える
+// varsにない変数があればErrUndefinedVariableを返す
+func Render(src string, vars map[string]string) (string, error) {
+	if _, err := Variables(src); err != nil {
+		return "", err
+	}
+
+	var undefined string
+	res := variablePattern.ReplaceAllStringFunc(src, func(s string) string {
+		name := strings.TrimSpace(s[2 : len(s)-2])
+		value, ok := vars[name]
+		if !ok && undefined == "" {
+			undefined = name
+		}
+
+		return value
+	})
+	if undefined != "" {
+		return "", fmt.Errorf("%w: %s", ErrUndefinedVariable, undefined)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,58 @@
+package notetemplate
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	vars := Context{
+		Now:         time.Date(2025, 6, 30, 16, 5, 0, 0, time.UTC),
+		ChannelPath: "event/hackathon/25spring",
+		Author:      "toki",
+		Number:      12,
+	}.Variables()
+	vars["place"] = "部室"
+
+	tests := []struct {
+		src     string
+		want    string
+		wantErr error
+	}{
+		{src: "第{{number}}回 議事録", want: "第12回 議事録"},
+		{src: "# {{ channel }} {{date}} {{time}}\n書記: @{{author}}", want: "# 25spring 2025-07-01 01:05\n書記: @toki"},
+		{src: "#{{channelPath}} @ {{place}}", want: "#event/hackathon/25spring @ 部室"},
+		{src: "{{unknown}}", wantErr: ErrUndefinedVariable},
+		{src: "{{ 1st }}", wantErr: ErrInvalidVariable},
+		{src: "変数なし {} {{", want: "変数なし {} {{"},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.src, vars)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Render(%q) error = %v, want %v", tt.src, err, tt.wantErr)
+
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	got, err := Variables("第{{number}}回 {{ channel }} {{number}} {{place}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"number", "channel", "place"}; !slices.Equal(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+	if !Uses("第{{ number }}回", NumberVariable) || Uses("{{date}}", NumberVariable) {
+		t.Error("Uses() returned an unexpected result")
+	}
+	if !IsBuiltin("author") || IsBuiltin("place") {
+		t.Error("IsBuiltin() returned an unexpected result")
+	}
+}
@@ -0,0 +1,105 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	traq "github.com/traPtitech/go-traq"
+)
+
+// MessageAPI traQのメッセージAPIのうち通知に必要な部分
+type MessageAPI interface {
+	// PostMessage チャンネルにメッセージを投稿し，投稿したメッセージのUUIDを返す
+	PostMessage(ctx context.Context, channelID string, content string) (string, error)
+	// EditMessage 投稿済みのメッセージを編集する
+	EditMessage(ctx context.Context, messageID string, content string) error
+}
+
+type traqMessageAPI struct {
+	client *traq.APIClient
+	token  string
+}
+
+// NewTraQMessageAPI BOTのアクセストークンを使ってtraQにメッセージを投稿するMessageAPIを返す
+func NewTraQMessageAPI(token string) MessageAPI {
+	return &traqMessageAPI{
+		client: traq.NewAPIClient(traq.NewConfiguration()),
+		token:  token,
+	}
+}
+
+func (a *traqMessageAPI) PostMessage(ctx context.Context, channelID string, content string) (string, error) {
+	auth := context.WithValue(ctx, traq.ContextAccessToken, a.token)
+	message, _, err := a.client.MessageApi.PostMessage(auth, channelID).
+		PostMessageRequest(traq.PostMessageRequest{Content: content}).
+		Execute()
+	if err != nil {
+		return "", fmt.Errorf("post message to traQ: %w", err)
+	}
+
+	return message.Id, nil
+}
+
+func (a *traqMessageAPI) EditMessage(ctx context.Context, messageID string, content string) error {
+	auth := context.WithValue(ctx, traq.ContextAccessToken, a.token)
+	_, err := a.client.MessageApi.EditMessage(auth, messageID).
+		PostMessageRequest(traq.PostMessageRequest{Content: content}).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("edit message in traQ: %w", err)
+	}
+
+	return nil
+}
+
+// FakeMessage FakeMessageAPIに投稿されたメッセージ
+type FakeMessage struct {
+	ID        string
+	ChannelID string
+	Content   string
+	Edited    bool
+}
+
+// FakeMessageAPI テスト用のメッセージAPI．投稿されたメッセージをメモリ上に保持する
+type FakeMessageAPI struct {
+	mu       sync.Mutex
+	Messages map[string]*FakeMessage
+	// Err nilでない場合，すべての呼び出しがこのエラーを返す
+	Err error
+}
+
+func NewFakeMessageAPI() *FakeMessageAPI {
+	return &FakeMessageAPI{Messages: map[string]*FakeMessage{}}
+}
+
+func (a *FakeMessageAPI) PostMessage(_ context.Context, channelID string, content string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.Err != nil {
+		return "", a.Err
+	}
+	id := uuid.NewString()
+	a.Messages[id] = &FakeMessage{ID: id, ChannelID: channelID, Content: content}
+
+	return id, nil
+}
+
+func (a *FakeMessageAPI) EditMessage(_ context.Context, messageID string, content string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.Err != nil {
+		return a.Err
+	}
+	message, ok := a.Messages[messageID]
+	if !ok {
+		return fmt.Errorf("message %s not found", messageID)
+	}
+	message.Content = content
+	message.Edited = true
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/traP-jp/circuledge-backend/internal/traqbot"
+)
+
+// Notification traQに告知するノートの情報
+type Notification struct {
+	NoteID    string
+	ChannelID string
+	Title     string
+	Summary   string
+	// MessageID 以前に投稿したメッセージがある場合はそのUUID．空の場合は新しく投稿する
+	MessageID string
+	// Published ノートが公開されたことによる通知かどうか
+	Published bool
+}
+
+// Notifier ノートの公開・更新をtraQのチャンネルに告知する
+type Notifier struct {
+	api     MessageAPI
+	baseURL string
+}
+
+func New(api MessageAPI, baseURL string) *Notifier {
+	return &Notifier{
+		api:     api,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Notify 告知メッセージを投稿（MessageIDがあれば編集）し，メッセージのUUIDを返す
+func (n *Notifier) Notify(ctx context.Context, notification Notification) (string, error) {
+	content := n.content(notification)
+	if notification.MessageID != "" {
+		if err := n.api.EditMessage(ctx, notification.MessageID, content); err != nil {
+			return "", err
+		}
+
+		return notification.MessageID, nil
+	}
+
+	return n.api.PostMessage(ctx, notification.ChannelID, content)
+}
+
+// NotifySaved traQのメッセージをノートとして保存したことを返信し，返信したメッセージのUUIDを返す
+func (n *Notifier) NotifySaved(ctx context.Context, channelID string, noteID string, title string) (string, error) {
+	content := fmt.Sprintf(":white_check_mark: ノート **%s** として保存しました\n%s\n:%s: を押すと元のメッセージの内容で更新します",
+		title, n.noteURL(noteID), traqbot.UpdateStampName)
+
+	return n.api.PostMessage(ctx, channelID, content)
+}
+
+func (n *Notifier) noteURL(noteID string) string {
+	return n.baseURL + "/notes/" + noteID
+}
+
+func (n *Notifier) content(notification Notification) string {
+	action := "更新されました"
+	if notification.Published {
+		action = "公開されました"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, ":memo: ノート **%s** が%s\n", notification.Title, action)
+	if notification.Summary != "" {
+		for _, line := range strings.Split(notification.Summary, "\n") {
+			fmt.Fprintf(&b, "> %s\n", line)
+		}
+	}
+	b.WriteString(n.noteURL(notification.NoteID))
+
+	return b.String()
+}
+
+// IsSignificantEdit 告知し直す価値のある編集かどうかを判定する
+// タイトルが変わった場合か，本文の長さが大きく変わった場合に告知する
+func IsSignificantEdit(prevTitle, prevBody, title, body string) bool {
+	if prevTitle != title {
+		return true
+	}
+
+	prevLen := len([]rune(prevBody))
+	diff := len([]rune(body)) - prevLen
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff >= 200 || (prevLen > 0 && diff*5 >= prevLen)
+}
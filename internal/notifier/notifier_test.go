@@ -0,0 +1,84 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNotifyPostsThenEdits(t *testing.T) {
+	api := NewFakeMessageAPI()
+	n := New(api, "https://circuledge.trap.show/")
+
+	messageID, err := n.Notify(context.Background(), Notification{
+		NoteID:    "note",
+		ChannelID: "channel",
+		Title:     "議事録",
+		Summary:   "要約",
+		Published: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, ok := api.Messages[messageID]
+	if !ok {
+		t.Fatalf("message %s was not posted", messageID)
+	}
+	if message.ChannelID != "channel" {
+		t.Errorf("posted to %s, want channel", message.ChannelID)
+	}
+	if !strings.Contains(message.Content, "https://circuledge.trap.show/notes/note") {
+		t.Errorf("content does not contain link: %q", message.Content)
+	}
+
+	editedID, err := n.Notify(context.Background(), Notification{
+		NoteID:    "note",
+		ChannelID: "channel",
+		Title:     "議事録（改訂）",
+		MessageID: messageID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if editedID != messageID {
+		t.Errorf("got message %s, want %s", editedID, messageID)
+	}
+	if len(api.Messages) != 1 || !message.Edited || !strings.Contains(message.Content, "議事録（改訂）") {
+		t.Errorf("message was not edited: %+v", message)
+	}
+}
+
+func TestNotifyError(t *testing.T) {
+	api := NewFakeMessageAPI()
+	api.Err = errors.New("unavailable")
+	n := New(api, "https://circuledge.trap.show")
+
+	if _, err := n.Notify(context.Background(), Notification{NoteID: "note", ChannelID: "channel"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestIsSignificantEdit(t *testing.T) {
+	tests := []struct {
+		name      string
+		prevTitle string
+		prevBody  string
+		title     string
+		body      string
+		want      bool
+	}{
+		{"title changed", "a", "body", "b", "body", true},
+		{"typo fix", "a", strings.Repeat("x", 100), "a", strings.Repeat("x", 101), false},
+		{"large addition", "a", strings.Repeat("x", 100), "a", strings.Repeat("x", 130), true},
+		{"long note small edit", "a", strings.Repeat("x", 5000), "a", strings.Repeat("x", 5100), false},
+		{"long note large edit", "a", strings.Repeat("x", 5000), "a", strings.Repeat("x", 5300), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSignificantEdit(tt.prevTitle, tt.prevBody, tt.title, tt.body); got != tt.want {
+				t.Errorf("IsSignificantEdit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
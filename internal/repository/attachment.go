@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/traP-jp/circuledge-backend/internal/attachment"
+	"github.com/traP-jp/circuledge-backend/internal/blobstore"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+type (
+	Attachment struct {
+		ID           string `json:"id" db:"id"`
+		NoteID       string `json:"noteId" db:"note_id"`
+		FileName     string `json:"fileName" db:"file_name"`
+		ContentType  string `json:"contentType" db:"content_type"`
+		Size         int64  `json:"size" db:"size"`
+		HasThumbnail bool   `json:"hasThumbnail" db:"-"`
+		UploadedBy   string `json:"uploadedBy" db:"uploaded_by"`
+		CreatedAt    int32  `json:"createdAt" db:"created_at"`
+
+		BlobKey      string         `json:"-" db:"blob_key"`
+		ThumbnailKey sql.NullString `json:"-" db:"thumbnail_key"`
+		// Permission 添付先のノートの権限
+		Permission string `json:"-" db:"permission"`
+	}
+
+	CreateAttachmentParams struct {
+		NoteID   string
+		FileName string
+		// UserName アップロードしたユーザーのtraQ ID
+		UserName string
+		Data     []byte
+	}
+)
+
+// CreateAttachment ファイルをノートに添付する．画像の場合はサムネイルも保存する
+// ユーザーが読めないノートにはErrNoteNotFoundを返し，ファイルを保存しない
+// ファイルの種類は内容から判定し，添付できない種類やサイズの場合はattachmentパッケージのエラーを返す
+func (r *Repository) CreateAttachment(ctx context.Context, params CreateAttachmentParams) (*Attachment, error) {
+	if params.UserName == "" {
+		return nil, ErrForbidden
+	}
+	permission, err := r.getNotePermission(ctx, params.NoteID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanReadNote(permission, params.UserName) {
+		return nil, ErrNoteNotFound
+	}
+	contentType, err := attachment.DetectContentType(params.FileName, params.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := uuid.NewV7()
+	a := &Attachment{
+		ID:          id.String(),
+		NoteID:      params.NoteID,
+		FileName:    attachment.SanitizeFileName(params.FileName),
+		ContentType: contentType,
+		Size:        int64(len(params.Data)),
+		UploadedBy:  params.UserName,
+		CreatedAt:   int32(time.Now().Unix()),
+		BlobKey:     "attachments/" + params.NoteID + "/" + id.String(),
+		Permission:  permission,
+	}
+	if err := r.blobs.Put(ctx, a.BlobKey, bytes.NewReader(params.Data), contentType); err != nil {
+		return nil, fmt.Errorf("put attachment: %w", err)
+	}
+
+	thumbnail, err := attachment.Thumbnail(contentType, params.Data)
+	switch {
+	case err == nil:
+		key := a.BlobKey + "_thumbnail"
+		if err := r.blobs.Put(ctx, key, bytes.NewReader(thumbnail), "image/png"); err != nil {
+			log.Printf("failed to put thumbnail of attachment %s: %v", a.ID, err)
+		} else {
+			a.ThumbnailKey = sql.NullString{String: key, Valid: true}
+			a.HasThumbnail = true
+		}
+	case !errors.Is(err, attachment.ErrNoThumbnail):
+		// 壊れた画像でも添付自体は受け付ける
+		log.Printf("failed to create thumbnail of attachment %s: %v", a.ID, err)
+	}
+
+	query := `INSERT INTO attachments (id, note_id, file_name, content_type, size, blob_key, thumbnail_key, uploaded_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = r.db.Exec(query, a.ID, a.NoteID, a.FileName, a.ContentType, a.Size, a.BlobKey, a.ThumbnailKey, a.UploadedBy, a.CreatedAt)
+	if err != nil {
+		r.deleteAttachmentBlobs(ctx, a)
+
+		return nil, fmt.Errorf("insert attachment: %w", err)
+	}
+	signal(r.attachmentQueued)
+
+	return a, nil
+}
+
+func (r *Repository) deleteAttachmentBlobs(ctx context.Context, a *Attachment) {
+	if err := r.blobs.Delete(ctx, a.BlobKey); err != nil {
+		log.Printf("failed to delete attachment blob %s: %v", a.BlobKey, err)
+	}
+	if a.ThumbnailKey.Valid {
+		if err := r.blobs.Delete(ctx, a.ThumbnailKey.String); err != nil {
+			log.Printf("failed to delete attachment blob %s: %v", a.ThumbnailKey.String, err)
+		}
+	}
+}
+
+// getNotePermission 削除されていないノートの最新リビジョンの権限を取得する
+func (r *Repository) getNotePermission(_ context.Context, noteID string) (string, error) {
+	var permission string
+	query := `SELECT rev.permission FROM notes n JOIN note_revisions rev ON rev.revision_id = n.latest_revision WHERE n.id = ? AND n.deleted_at IS NULL`
+	err := r.db.QueryRow(query, noteID).Scan(&permission)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNoteNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("select note permission: %w", err)
+	}
+
+	return permission, nil
+}
+
+// attachmentColumns 添付先のノートの権限を含めて添付ファイルを取得するためのSELECT句
+const attachmentColumns = `SELECT a.id, a.note_id, a.file_name, a.content_type, a.size, a.blob_key, a.thumbnail_key, a.uploaded_by, a.created_at, rev.permission
+	FROM attachments a
+	JOIN notes n ON n.id = a.note_id AND n.deleted_at IS NULL
+	JOIN note_revisions rev ON rev.revision_id = n.latest_revision`
+
+// GetAttachment 添付ファイルを取得する
+// 添付先のノートをuserNameが読めない場合は，ノートの取得と同じく存在しないものとして扱う
+func (r *Repository) GetAttachment(_ context.Context, attachmentID string, userName string) (*Attachment, error) {
+	var a Attachment
+	err := r.db.Get(&a, attachmentColumns+` WHERE a.id = ?`, attachmentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select attachment: %w", err)
+	}
+	if !CanReadNote(a.Permission, userName) {
+		return nil, ErrAttachmentNotFound
+	}
+	a.HasThumbnail = a.ThumbnailKey.Valid
+
+	return &a, nil
+}
+
+// GetNoteAttachments ノートの添付ファイルを古い順に取得する
+// ノートをuserNameが読めない場合はErrNoteNotFoundを返す
+func (r *Repository) GetNoteAttachments(ctx context.Context, noteID string, userName string) ([]Attachment, error) {
+	permission, err := r.getNotePermission(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanReadNote(permission, userName) {
+		return nil, ErrNoteNotFound
+	}
+
+	rows := []Attachment{}
+	if err := r.db.Select(&rows, attachmentColumns+` WHERE a.note_id = ? ORDER BY a.created_at, a.id`, noteID); err != nil {
+		return nil, fmt.Errorf("select attachments: %w", err)
+	}
+
+	for i := range rows {
+		rows[i].HasThumbnail = rows[i].ThumbnailKey.Valid
+	}
+
+	return rows, nil
+}
+
+// OpenAttachment 添付ファイルの内容を開く．thumbnailがtrueの場合はサムネイルを開く
+func (r *Repository) OpenAttachment(ctx context.Context, a *Attachment, thumbnail bool) (io.ReadCloser, error) {
+	key := a.BlobKey
+	if thumbnail {
+		if !a.ThumbnailKey.Valid {
+			return nil, ErrAttachmentNotFound
+		}
+		key = a.ThumbnailKey.String
+	}
+
+	body, err := r.blobs.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAttachmentTextQuery(t *testing.T) {
+	b, err := json.Marshal(attachmentTextQuery("合宿"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"nested":{"ignore_unmapped":true,"inner_hits":{"_source":{"includes":["attachments.id","attachments.fileName"]},"name":"attachments"},"path":"attachments","query":{"match":{"attachments.text":{"query":"合宿"}}}}}`
+	if string(b) != want {
+		t.Errorf("attachmentTextQuery() = %s, want %s", b, want)
+	}
+}
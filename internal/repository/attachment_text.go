@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/traP-jp/circuledge-backend/internal/attachment"
+	"github.com/traP-jp/circuledge-backend/internal/textextract"
+)
+
+// attachmentsField 添付ファイルから取り出したテキストを入れるnestedフィールド
+// ファイルごとに一致したかを判定できるよう，nestedとしてマッピングする
+const attachmentsField = "attachments"
+
+type (
+	// attachmentDocument ESのノートのドキュメントに入れる添付ファイル
+	attachmentDocument struct {
+		ID          string `json:"id"`
+		FileName    string `json:"fileName"`
+		ContentType string `json:"contentType"`
+		Text        string `json:"text"`
+	}
+
+	// MatchedAttachment 検索語に一致した添付ファイル
+	MatchedAttachment struct {
+		ID       string `json:"id"`
+		FileName string `json:"fileName"`
+	}
+)
+
+func attachmentsMapping() types.Property {
+	nested := types.NewNestedProperty()
+	nested.Properties = map[string]types.Property{
+		"id":          types.NewKeywordProperty(),
+		"fileName":    types.NewKeywordProperty(),
+		"contentType": types.NewKeywordProperty(),
+		"text":        types.NewTextProperty(),
+	}
+
+	return nested
+}
+
+// attachmentTextQuery 添付ファイルのテキストがqueryTextに一致するノートを探すクエリ
+// 一致した添付ファイルをinner_hitsとして返す
+func attachmentTextQuery(queryText string) types.Query {
+	return types.Query{
+		Nested: &types.NestedQuery{
+			Path:  attachmentsField,
+			Query: NewMatchQuery(attachmentsField+".text", queryText),
+			InnerHits: &types.InnerHits{
+				Name:    some.String(attachmentsField),
+				Source_: &types.SourceFilter{Includes: []string{attachmentsField + ".id", attachmentsField + ".fileName"}},
+			},
+			IgnoreUnmapped: some.Bool(true),
+		},
+	}
+}
+
+// matchedAttachments 検索結果のinner_hitsから一致した添付ファイルを取り出す
+func matchedAttachments(hit types.Hit) ([]MatchedAttachment, error) {
+	inner, ok := hit.InnerHits[attachmentsField]
+	if !ok {
+		return nil, nil
+	}
+
+	attachments := make([]MatchedAttachment, 0, len(inner.Hits.Hits))
+	for _, h := range inner.Hits.Hits {
+		var a MatchedAttachment
+		if err := json.Unmarshal(h.Source_, &a); err != nil {
+			return nil, fmt.Errorf("unmarshal matched attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, nil
+}
+
+// maxTextExtractionAttempts 添付ファイルからのテキストの取り出しを諦めるまでの試行回数
+const maxTextExtractionAttempts = 3
+
+// attachmentText テキストの取り出しを待っている添付ファイル
+type attachmentText struct {
+	Attachment
+	Status        string         `db:"text_status"`
+	ExtractedText sql.NullString `db:"extracted_text"`
+}
+
+// ProcessAttachmentTexts 添付ファイルからテキストを取り出してMySQLに保存し，保存したテキストをESのノートのドキュメントに登録する
+// ESへの登録に失敗した添付ファイルは，取り出し直さずに保存したテキストで登録し直す
+func (r *Repository) ProcessAttachmentTexts(ctx context.Context) error {
+	if r.extractor == nil {
+		return nil
+	}
+
+	queued := []attachmentText{}
+	query := `SELECT a.id, a.note_id, a.file_name, a.content_type, a.size, a.blob_key, a.text_status, a.extracted_text
+		FROM attachments a
+		JOIN notes n ON n.id = a.note_id AND n.deleted_at IS NULL
+		WHERE a.text_status IN ('pending', 'extracted') OR (a.text_status = 'failed' AND a.text_attempts < ?)
+		ORDER BY a.created_at, a.id`
+	if err := r.db.Select(&queued, query, maxTextExtractionAttempts); err != nil {
+		return fmt.Errorf("select queued attachment texts: %w", err)
+	}
+
+	for _, a := range queued {
+		text := a.ExtractedText.String
+		if a.Status != "extracted" {
+			extracted, ok, err := r.extractAttachmentText(ctx, &a.Attachment)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			text = extracted
+		}
+		r.indexAttachmentText(ctx, &a.Attachment, text)
+	}
+
+	return nil
+}
+
+// extractAttachmentText 添付ファイルからテキストを取り出してMySQLに保存する
+// 取り出せなかった場合はその結果を記録し，okをfalseにする
+func (r *Repository) extractAttachmentText(ctx context.Context, a *Attachment) (text string, ok bool, err error) {
+	text, err = r.readAttachmentText(ctx, a)
+	if errors.Is(err, textextract.ErrUnsupported) {
+		if _, err := r.db.Exec(`UPDATE attachments SET text_status = 'unsupported' WHERE id = ?`, a.ID); err != nil {
+			return "", false, fmt.Errorf("mark attachment text unsupported: %w", err)
+		}
+
+		return "", false, nil
+	}
+	if err != nil {
+		log.Printf("failed to extract text from attachment %s: %v", a.ID, err)
+		if _, err := r.db.Exec(`UPDATE attachments SET text_status = 'failed', text_attempts = text_attempts + 1 WHERE id = ?`, a.ID); err != nil {
+			return "", false, fmt.Errorf("mark attachment text failed: %w", err)
+		}
+
+		return "", false, nil
+	}
+
+	query := `UPDATE attachments SET extracted_text = ?, text_status = 'extracted', text_attempts = text_attempts + 1 WHERE id = ?`
+	if _, err := r.db.Exec(query, text, a.ID); err != nil {
+		return "", false, fmt.Errorf("save attachment text: %w", err)
+	}
+
+	return text, true, nil
+}
+
+func (r *Repository) readAttachmentText(ctx context.Context, a *Attachment) (string, error) {
+	body, err := r.blobs.Get(ctx, a.BlobKey)
+	if err != nil {
+		return "", fmt.Errorf("get attachment: %w", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, attachment.MaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("read attachment: %w", err)
+	}
+
+	return r.extractor.Extract(ctx, a.ContentType, data)
+}
+
+// indexAttachmentText 添付ファイルから取り出したテキストをESのノートのドキュメントに登録する
+// 失敗した場合はtext_statusをextractedのままにし，次の実行で登録し直す
+func (r *Repository) indexAttachmentText(ctx context.Context, a *Attachment, text string) {
+	params, err := json.Marshal(attachmentDocument{
+		ID:          a.ID,
+		FileName:    a.FileName,
+		ContentType: a.ContentType,
+		Text:        text,
+	})
+	if err != nil {
+		log.Printf("failed to marshal attachment %s: %v", a.ID, err)
+
+		return
+	}
+	_, err = r.es.Update("notes", a.NoteID).Script(&types.Script{
+		Source: "if (ctx._source.attachments == null) { ctx._source.attachments = [] } " +
+			"ctx._source.attachments.removeIf(a -> a.id == params.attachment.id); " +
+			"ctx._source.attachments.add(params.attachment)",
+		Params: map[string]json.RawMessage{"attachment": params},
+	}).Do(ctx)
+	if err != nil {
+		log.Printf("failed to index text of attachment %s: %v", a.ID, err)
+
+		return
+	}
+
+	if _, err := r.db.Exec(`UPDATE attachments SET text_status = 'indexed' WHERE id = ?`, a.ID); err != nil {
+		log.Printf("DB Error: %s", err)
+	}
+}
+
+// WatchAttachmentTexts 添付ファイルがアップロードされたときと一定間隔ごとにProcessAttachmentTextsを実行する
+func (r *Repository) WatchAttachmentTexts(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, r.attachmentQueued, func() {
+		if err := r.ProcessAttachmentTexts(ctx); err != nil {
+			log.Printf("process attachment texts: %s", err)
+		}
+	})
+}
@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// MaxBulkNotes 一括操作で一度に対象にできるノートの最大数
+const MaxBulkNotes = 1000
+
+// 一括操作の種類
+const (
+	BulkActionMoveChannel      = "move-channel"
+	BulkActionChangePermission = "change-permission"
+	BulkActionAddTag           = "add-tag"
+	BulkActionRemoveTag        = "remove-tag"
+	BulkActionDelete           = "delete"
+)
+
+// 一括操作のノートごとの結果
+const (
+	BulkStatusOK      = "ok"
+	BulkStatusSkipped = "skipped"
+	BulkStatusError   = "error"
+)
+
+var ErrTooManyNotes = errors.New("too many notes")
+
+type (
+	DuplicateNoteParams struct {
+		UserName string
+		// Channel 複製先のチャンネル．uuid.Nilの場合は複製元と同じチャンネルにする
+		Channel uuid.UUID
+	}
+
+	BulkAction struct {
+		Type string
+		// Channel move-channelの移動先
+		Channel uuid.UUID
+		// Permission change-permissionの変更後の権限
+		Permission string
+		// Tag add-tag・remove-tagのタグ
+		Tag string
+	}
+
+	// BulkResult 一括操作のノートごとの結果
+	BulkResult struct {
+		NoteID string `json:"noteId"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+)
+
+// DuplicateNote ノートの最新リビジョンを新しいノートとして複製する
+// 添付ファイル・コメント・スターは複製しない
+func (r *Repository) DuplicateNote(ctx context.Context, noteID string, params DuplicateNoteParams) (*NoteResponse, error) {
+	exists, err := r.noteExists(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNoteNotFound
+	}
+	note, err := r.getNoteDocument(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	channelID := params.Channel
+	if channelID == uuid.Nil {
+		if channelID, err = uuid.Parse(note.Channel); err != nil {
+			return nil, fmt.Errorf("parse channel ID: %w", err)
+		}
+	}
+
+	return r.CreateNote(ctx, CreateNoteParams{
+		UserName:   params.UserName,
+		Channel:    channelID,
+		Permission: note.Permission,
+		Title:      note.Title,
+		Tags:       note.Tag,
+		Body:       note.Body,
+	})
+}
+
+// bulkNotesQuery 一括操作の対象をフィルタで選ぶクエリ
+// 書き出しと同じく，params.UserNameの一覧に含まれるノートだけを対象にする
+func bulkNotesQuery(params GetNotesParams) *types.Query {
+	return &types.Query{
+		Bool: &types.BoolQuery{
+			Filter: []types.Query{*buildNotesQuery(params), listedNotesQuery(params.UserName)},
+		},
+	}
+}
+
+// SearchNoteIDs GetNotesと同じ条件に一致するノートのうち，params.UserNameの一覧に含まれるノートのIDを取得する
+// 一致するノートがMaxBulkNotesより多い場合はErrTooManyNotesを返す
+func (r *Repository) SearchNoteIDs(ctx context.Context, params GetNotesParams) ([]string, error) {
+	params, err := r.withTagSynonyms(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	query := bulkNotesQuery(params)
+	res, err := r.es.Search().Index("notes").Query(query).Source_(&types.SourceFilter{Includes: []string{"id"}}).Size(MaxBulkNotes + 1).Do(ctx)
+	if err != nil {
+		return nil, searchError(fmt.Errorf("search notes in ES: %w", err))
+	}
+	if len(res.Hits.Hits) > MaxBulkNotes {
+		return nil, ErrTooManyNotes
+	}
+
+	noteIDs := make([]string, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		var doc struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+			return nil, fmt.Errorf("unmarshal note data: %w", err)
+		}
+		noteIDs = append(noteIDs, doc.ID)
+	}
+
+	return noteIDs, nil
+}
+
+// BulkUpdateNotes ノートごとに操作を適用し，結果を返す
+// 削除以外の操作はノートごとに新しいリビジョンを作る．失敗したノートがあっても残りのノートの操作を続ける
+func (r *Repository) BulkUpdateNotes(ctx context.Context, noteIDs []string, action BulkAction, userName string) []BulkResult {
+	results := make([]BulkResult, 0, len(noteIDs))
+	for _, noteID := range noteIDs {
+		result := BulkResult{NoteID: noteID, Status: BulkStatusOK}
+		changed, err := r.applyBulkAction(ctx, noteID, action, userName)
+		switch {
+		case err != nil:
+			result.Status = BulkStatusError
+			result.Error = bulkErrorReason(noteID, err)
+		case !changed:
+			result.Status = BulkStatusSkipped
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// bulkErrorReason ノートごとの操作に失敗した理由を返す
+// 理由は決まった文言にし，内部のエラーはサーバーのログにだけ出す
+func bulkErrorReason(noteID string, err error) string {
+	var httpErr *echo.HTTPError
+	isHTTPErr := errors.As(err, &httpErr)
+	switch {
+	case errors.Is(err, ErrNoteNotFound), isHTTPErr && httpErr.Code == http.StatusNotFound:
+		return "note not found"
+	case errors.Is(err, ErrForbidden), isHTTPErr && httpErr.Code == http.StatusForbidden:
+		return "permission denied"
+	case isHTTPErr && httpErr.Code == http.StatusConflict:
+		return "revision conflict"
+	case isHTTPErr && httpErr.Code < http.StatusInternalServerError:
+		// UpdateNoteなどがクライアント向けに用意した文言
+		return fmt.Sprint(httpErr.Message)
+	}
+
+	log.Printf("failed to apply bulk operation to note %s: %v", noteID, err)
+
+	return "internal error"
+}
+
+// applyBulkAction 1つのノートに操作を適用する．変更がなかった場合はfalseを返す
+// userNameが読めないノートは，ノートの取得と同じく存在しないものとして扱う
+func (r *Repository) applyBulkAction(ctx context.Context, noteID string, action BulkAction, userName string) (bool, error) {
+	permission, err := r.getNotePermission(ctx, noteID)
+	if err != nil {
+		return false, err
+	}
+	if !CanReadNote(permission, userName) {
+		return false, ErrNoteNotFound
+	}
+
+	if action.Type == BulkActionDelete {
+		if err := r.DeleteNote(ctx, noteID); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return false, fmt.Errorf("parse note ID: %w", err)
+	}
+	note, err := r.getNoteDocument(ctx, noteID)
+	if err != nil {
+		return false, err
+	}
+	channelID, err := uuid.Parse(note.Channel)
+	if err != nil {
+		return false, fmt.Errorf("parse channel ID: %w", err)
+	}
+	revisionID, _ := uuid.Parse(note.LatestRevision)
+	// タイトル・要約・タグは本文から導出し直さず，現在の値を保つ
+	params := UpdateNoteParams{
+		UserName:   userName,
+		Channel:    channelID,
+		Permission: note.Permission,
+		Revision:   revisionID,
+		Body:       note.Body,
+		Tags:       slices.Clone(note.Tag),
+		Title:      note.Title,
+		Summary:    note.Summary,
+	}
+	if params.Tags == nil {
+		params.Tags = []string{}
+	}
+
+	switch action.Type {
+	case BulkActionMoveChannel:
+		if params.Channel == action.Channel {
+			return false, nil
+		}
+		params.Channel = action.Channel
+	case BulkActionChangePermission:
+		if params.Permission == action.Permission {
+			return false, nil
+		}
+		params.Permission = action.Permission
+	case BulkActionAddTag:
+		if slices.Contains(params.Tags, action.Tag) {
+			return false, nil
+		}
+		params.Tags = append(params.Tags, action.Tag)
+	case BulkActionRemoveTag:
+		if !slices.Contains(params.Tags, action.Tag) {
+			return false, nil
+		}
+		params.Tags = slices.DeleteFunc(params.Tags, func(tag string) bool { return tag == action.Tag })
+	default:
+		return false, fmt.Errorf("invalid bulk action: %s", action.Type)
+	}
+
+	if err := r.UpdateNote(ctx, id, params); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestBulkNotesQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		params GetNotesParams
+		want   string
+	}{
+		{
+			name:   "logged in",
+			params: GetNotesParams{UserName: "toki", Channel: "c1"},
+			want:   `{"bool":{"filter":[{"bool":{"filter":[{"term":{"channel.keyword":{"value":"c1"}}}]}},{"terms":{"permission.keyword":["public","limited"]}}]}}`,
+		},
+		{
+			name:   "anonymous",
+			params: GetNotesParams{Channel: "c1"},
+			want:   `{"bool":{"filter":[{"bool":{"filter":[{"term":{"channel.keyword":{"value":"c1"}}}]}},{"terms":{"permission.keyword":["public"]}}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(bulkNotesQuery(tt.params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s: bulkNotesQuery() = %s, want %s", tt.name, b, tt.want)
+		}
+	}
+}
+
+func TestBulkErrorReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: ErrNoteNotFound, want: "note not found"},
+		{err: fmt.Errorf("select note: %w", ErrNoteNotFound), want: "note not found"},
+		{err: echo.NewHTTPError(http.StatusNotFound, "not found"), want: "note not found"},
+		{err: fmt.Errorf("select template: %w", ErrForbidden), want: "permission denied"},
+		{err: echo.NewHTTPError(http.StatusConflict, "revision conflict"), want: "revision conflict"},
+		{
+			err:  echo.NewHTTPError(http.StatusInternalServerError, "internal server error").SetInternal(errors.New("insert note revision: deadlock")),
+			want: "internal error",
+		},
+		{err: echo.NewHTTPError(http.StatusBadRequest, "invalid channel"), want: "invalid channel"},
+		{err: errors.New("update note in ES: timeout"), want: "internal error"},
+	}
+	for _, tt := range tests {
+		if got := bulkErrorReason("0197882d-208b-7c5a-bf60-89eafb904106", tt.err); got != tt.want {
+			t.Errorf("bulkErrorReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -4,39 +4,265 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 
 	traqforest "github.com/comavius/traq-channel-forest-go"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/google/uuid"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
 	traq "github.com/traPtitech/go-traq"
 )
 
-type Channel struct {
-	ID   string `json:"id"`
-	Path string `json:"path"`
+var ErrChannelNotFound = errors.New("channel not found")
+
+type (
+	Channel struct {
+		ID       string `json:"id"`
+		Path     string `json:"path"`
+		Archived bool   `json:"archived"`
+	}
+
+	GetChannelsParams struct {
+		// UserName ログイン中のユーザーのtraQ ID．空の場合はtraQのチャンネルを見られないものとする
+		UserName        string
+		IncludeArchived bool
+	}
+)
+
+// ChannelTreeNode チャンネルツリーの1ノード
+type ChannelTreeNode struct {
+	ID               string             `json:"id"`
+	Name             string             `json:"name"`
+	Path             string             `json:"path"`
+	Archived         bool               `json:"archived"`
+	NoteCount        int64              `json:"noteCount"`        // このチャンネル直下のノート数
+	SubtreeNoteCount int64              `json:"subtreeNoteCount"` // 子孫チャンネルを含めたノート数
+	Children         []*ChannelTreeNode `json:"children"`
 }
 
-func (r *Repository) GetChannels() ([]Channel, error) {
+// GET /channels
+// ログイン中のユーザーがtraQで見られるチャンネルを返す
+// traQの公開チャンネルはすべてのユーザーが見られるため，ログインしていない場合は空にし，ログイン中は公開チャンネルをすべて返す
+// DMチャンネルはユーザー自身のトークンがないと取得できないため含めない
+// パスの解決に失敗したチャンネルは結果から除外し，warningsとして返す
+func (r *Repository) GetChannels(ctx context.Context, params GetChannelsParams) ([]Channel, []string, error) {
+	if params.UserName == "" {
+		return []Channel{}, []string{}, nil
+	}
+
 	client := traq.NewAPIClient(traq.NewConfiguration())
-	auth := context.WithValue(context.Background(), traq.ContextAccessToken, r.token)
-	fmt.Println(r.token)
+	auth := context.WithValue(ctx, traq.ContextAccessToken, r.token)
 	c, _, err := client.ChannelApi.GetChannels(auth).Execute()
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("get channels from traQ: %w", err)
 	}
 	forest, err := traqforest.NewForest(client, &auth)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("build channel forest: %w", err)
 	}
-	var channels []Channel
+
+	channels := []Channel{}
+	warnings := []string{}
 	for _, t := range c.Public {
+		if t.Archived && !params.IncludeArchived {
+			continue
+		}
 		path, ok := forest.GetPath(t.Id)
 		if !ok {
-			return nil, errors.New("failed to get path for channel " + t.Id)
+			warnings = append(warnings, "failed to get path for channel "+t.Id)
+
+			continue
 		}
 		channels = append(channels, Channel{
-			ID:   t.Id,
-			Path: path,
+			ID:       t.Id,
+			Path:     path,
+			Archived: t.Archived,
 		})
 	}
 
-	return channels, nil
+	return channels, warnings, nil
+}
+
+// GET /channels/tree
+func (r *Repository) GetChannelTree(ctx context.Context, hideEmpty bool) ([]*ChannelTreeNode, error) {
+	client := traq.NewAPIClient(traq.NewConfiguration())
+	auth := context.WithValue(ctx, traq.ContextAccessToken, r.token)
+	c, _, err := client.ChannelApi.GetChannels(auth).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("get channels from traQ: %w", err)
+	}
+
+	counts, err := r.countNotesByChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*ChannelTreeNode, len(c.Public))
+	for _, ch := range c.Public {
+		nodes[ch.Id] = &ChannelTreeNode{
+			ID:        ch.Id,
+			Name:      ch.Name,
+			Archived:  ch.Archived,
+			NoteCount: counts[ch.Id],
+			Children:  []*ChannelTreeNode{},
+		}
+	}
+
+	roots := []*ChannelTreeNode{}
+	for _, ch := range c.Public {
+		node := nodes[ch.Id]
+		parentID := ch.ParentId.Get()
+		if parentID == nil {
+			roots = append(roots, node)
+
+			continue
+		}
+		parent, ok := nodes[*parentID]
+		if !ok {
+			// 親チャンネルが取得できない場合はルートとして扱う
+			roots = append(roots, node)
+
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	return buildChannelTree(roots, "", hideEmpty), nil
+}
+
+// buildChannelTree パスと部分木のノート数を埋め，必要なら空の部分木を取り除く
+func buildChannelTree(nodes []*ChannelTreeNode, parentPath string, hideEmpty bool) []*ChannelTreeNode {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	res := make([]*ChannelTreeNode, 0, len(nodes))
+	for _, node := range nodes {
+		node.Path = node.Name
+		if parentPath != "" {
+			node.Path = parentPath + "/" + node.Name
+		}
+		node.Children = buildChannelTree(node.Children, node.Path, hideEmpty)
+
+		node.SubtreeNoteCount = node.NoteCount
+		for _, child := range node.Children {
+			node.SubtreeNoteCount += child.SubtreeNoteCount
+		}
+		if hideEmpty && node.SubtreeNoteCount == 0 {
+			continue
+		}
+		res = append(res, node)
+	}
+
+	return res
+}
+
+// countNotesByChannel チャンネルごとのノート数をESのterms aggregationで取得する
+func (r *Repository) countNotesByChannel(ctx context.Context) (map[string]int64, error) {
+	res, err := r.es.Search().Index("notes").Size(0).Aggregations(map[string]types.Aggregations{
+		"channels": {
+			Terms: &types.TermsAggregation{
+				Field: some.String("channel.keyword"),
+				Size:  some.Int(10000),
+			},
+		},
+	}).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate notes by channel in ES: %w", err)
+	}
+
+	counts := map[string]int64{}
+	agg, ok := res.Aggregations["channels"].(*types.StringTermsAggregate)
+	if !ok {
+		return counts, nil
+	}
+	buckets, ok := agg.Buckets.([]types.StringTermsBucket)
+	if !ok {
+		return counts, nil
+	}
+	for _, bucket := range buckets {
+		key, ok := bucket.Key.(string)
+		if !ok {
+			continue
+		}
+		counts[key] = bucket.DocCount
+	}
+
+	return counts, nil
+}
+
+// ResolveChannel UUIDまたはチャンネルパス（`#event/hackathon`のような形式も可）をチャンネルUUIDに解決する
+func (r *Repository) ResolveChannel(ctx context.Context, channel string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(channel); err == nil {
+		return id, nil
+	}
+
+	path := strings.Trim(strings.TrimPrefix(strings.TrimSpace(channel), "#"), "/")
+	if path == "" {
+		return uuid.Nil, ErrChannelNotFound
+	}
+
+	client := traq.NewAPIClient(traq.NewConfiguration())
+	auth := context.WithValue(ctx, traq.ContextAccessToken, r.token)
+	forest, err := traqforest.NewForest(client, &auth)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("build channel forest: %w", err)
+	}
+	ch, ok := forest.GetChannel(path)
+	if !ok {
+		return uuid.Nil, ErrChannelNotFound
+	}
+
+	return uuid.Parse(ch.Id)
+}
+
+// channelPathResolver チャンネルUUIDからパスを引く関数を返す
+// レスポンスの補助情報として使うため，traQから取得できなかった場合は常に空文字列を返す
+func (r *Repository) channelPathResolver(ctx context.Context) func(channelID string) string {
+	client := traq.NewAPIClient(traq.NewConfiguration())
+	auth := context.WithValue(ctx, traq.ContextAccessToken, r.token)
+	forest, err := traqforest.NewForest(client, &auth)
+	if err != nil {
+		log.Printf("build channel forest: %s", err)
+
+		return func(string) string { return "" }
+	}
+
+	return func(channelID string) string {
+		path, _ := forest.GetPath(channelID)
+
+		return path
+	}
+}
+
+// channelIDResolver チャンネルパスからUUIDを引く関数を返す
+// 本文の解析に使うため，traQから取得できなかった場合はどのパスも解決しない
+func (r *Repository) channelIDResolver(ctx context.Context) notebody.ChannelResolver {
+	client, auth := r.traqClient(ctx)
+	forest, err := traqforest.NewForest(client, &auth)
+	if err != nil {
+		log.Printf("build channel forest: %s", err)
+
+		return func(string) (string, bool) { return "", false }
+	}
+
+	return func(path string) (string, bool) {
+		ch, ok := forest.GetChannel(path)
+
+		return ch.Id, ok
+	}
+}
+
+// ChannelExists ノートを作成できるチャンネルかどうか
+// アーカイブされたチャンネルは含めない．ノートの書き込み時と同じく，最後に同期したチャンネルの一覧で判定する
+func (r *Repository) ChannelExists(ctx context.Context, channelID uuid.UUID) (bool, error) {
+	ancestry, ok, err := r.lookupChannelAncestry(ctx, channelID)
+	if err != nil {
+		return false, err
+	}
+
+	return ok && !ancestry.Archived, nil
 }
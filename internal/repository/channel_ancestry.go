@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/conflicts"
+	"github.com/google/uuid"
+	traq "github.com/traPtitech/go-traq"
+)
+
+// channelAncestry ノートのドキュメントに書き込むチャンネルの祖先情報
+type channelAncestry struct {
+	// Ancestors 自身を含む祖先チャンネルのUUID（自身→ルートの順）
+	Ancestors []string
+	// Path チャンネルのフルパス
+	Path string
+	// Archived チャンネルがアーカイブされているか．ESには書き込まない
+	Archived bool
+}
+
+// channelAncestryCache 最後に同期したチャンネルの祖先情報
+type channelAncestryCache struct {
+	mu        sync.Mutex
+	ancestors map[string]channelAncestry
+}
+
+// buildChannelAncestries traQのチャンネル一覧から全チャンネルの祖先情報を組み立てる
+func buildChannelAncestries(channels []traq.Channel) map[string]channelAncestry {
+	byID := make(map[string]traq.Channel, len(channels))
+	for _, ch := range channels {
+		byID[ch.Id] = ch
+	}
+
+	res := make(map[string]channelAncestry, len(channels))
+	for _, ch := range channels {
+		ancestors := []string{}
+		path := ""
+		current, ok := ch, true
+		// 循環していても止まるようにチャンネル数で打ち切る
+		for i := 0; ok && i < len(channels); i++ {
+			ancestors = append(ancestors, current.Id)
+			if path == "" {
+				path = current.Name
+			} else {
+				path = current.Name + "/" + path
+			}
+			parentID := current.ParentId.Get()
+			if parentID == nil {
+				break
+			}
+			current, ok = byID[*parentID]
+		}
+		res[ch.Id] = channelAncestry{Ancestors: ancestors, Path: path, Archived: ch.Archived}
+	}
+
+	return res
+}
+
+func (r *Repository) fetchChannelAncestries(ctx context.Context) (map[string]channelAncestry, error) {
+	client := traq.NewAPIClient(traq.NewConfiguration())
+	auth := context.WithValue(ctx, traq.ContextAccessToken, r.token)
+	c, _, err := client.ChannelApi.GetChannels(auth).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("get channels from traQ: %w", err)
+	}
+
+	return buildChannelAncestries(c.Public), nil
+}
+
+// lookupChannelAncestry traQの公開チャンネルの祖先情報を取得する．チャンネルがない場合はokをfalseにする
+// 最後に同期した祖先情報を使い，同期後に作られたチャンネルだけtraQから取得する
+func (r *Repository) lookupChannelAncestry(ctx context.Context, channelID uuid.UUID) (ancestry channelAncestry, ok bool, err error) {
+	r.ancestryCache.mu.Lock()
+	ancestry, ok = r.ancestryCache.ancestors[channelID.String()]
+	r.ancestryCache.mu.Unlock()
+	if ok {
+		return ancestry, true, nil
+	}
+
+	// 移動を検知できるよう，キャッシュはSyncChannelAncestriesでのみ更新する
+	ancestries, err := r.fetchChannelAncestries(ctx)
+	if err != nil {
+		return channelAncestry{}, false, err
+	}
+	ancestry, ok = ancestries[channelID.String()]
+
+	return ancestry, ok, nil
+}
+
+// getChannelAncestry ノートの書き込み時にチャンネルの祖先情報を取得する
+// traQから取得できない場合は，同じチャンネルの既存のノートに書き込んだ祖先情報を使う
+// traQに存在しないチャンネル（未設定やDMなど）は自身のみを祖先とする
+func (r *Repository) getChannelAncestry(ctx context.Context, channelID uuid.UUID) (channelAncestry, error) {
+	ancestry, ok, err := r.lookupChannelAncestry(ctx, channelID)
+	if err != nil {
+		log.Printf("get channel ancestry of %s: %s", channelID, err)
+
+		return r.storedChannelAncestry(ctx, channelID)
+	}
+	if ok {
+		return ancestry, nil
+	}
+
+	return channelAncestry{Ancestors: []string{channelID.String()}}, nil
+}
+
+// storedChannelAncestry 同じチャンネルの既存のノートに書き込んだ祖先情報を取得する
+// ノートがない場合は自身のみを祖先とする
+func (r *Repository) storedChannelAncestry(ctx context.Context, channelID uuid.UUID) (channelAncestry, error) {
+	query := NewTermQuery("channel.keyword", channelID.String())
+	res, err := r.es.Search().Index("notes").Query(&query).
+		Source_(&types.SourceFilter{Includes: []string{"channelAncestors", "channelPath"}}).
+		Size(1).Do(ctx)
+	if err != nil {
+		return channelAncestry{}, fmt.Errorf("search channel ancestry in ES: %w", err)
+	}
+	for _, hit := range res.Hits.Hits {
+		var doc struct {
+			ChannelAncestors []string `json:"channelAncestors"`
+			ChannelPath      string   `json:"channelPath"`
+		}
+		if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+			return channelAncestry{}, fmt.Errorf("unmarshal note data: %w", err)
+		}
+		if len(doc.ChannelAncestors) > 0 {
+			return channelAncestry{Ancestors: doc.ChannelAncestors, Path: doc.ChannelPath}, nil
+		}
+	}
+
+	return channelAncestry{Ancestors: []string{channelID.String()}}, nil
+}
+
+// SyncChannelAncestries traQ上でチャンネルが移動・改名された場合に，該当チャンネルのノートの祖先情報を書き換える
+// 初回はすべてのチャンネルについて書き換える
+func (r *Repository) SyncChannelAncestries(ctx context.Context) error {
+	ancestries, err := r.fetchChannelAncestries(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.ancestryCache.mu.Lock()
+	defer r.ancestryCache.mu.Unlock()
+
+	for channelID, ancestry := range ancestries {
+		if prev, ok := r.ancestryCache.ancestors[channelID]; ok &&
+			prev.Path == ancestry.Path && slices.Equal(prev.Ancestors, ancestry.Ancestors) {
+			continue
+		}
+		if err := r.reindexChannelAncestry(ctx, channelID, ancestry); err != nil {
+			return err
+		}
+	}
+	r.ancestryCache.ancestors = ancestries
+
+	return nil
+}
+
+func (r *Repository) reindexChannelAncestry(ctx context.Context, channelID string, ancestry channelAncestry) error {
+	ancestors, err := json.Marshal(ancestry.Ancestors)
+	if err != nil {
+		return fmt.Errorf("marshal channel ancestors: %w", err)
+	}
+	path, err := json.Marshal(ancestry.Path)
+	if err != nil {
+		return fmt.Errorf("marshal channel path: %w", err)
+	}
+
+	query := NewTermQuery("channel.keyword", channelID)
+	_, err = r.es.UpdateByQuery("notes").
+		Query(&query).
+		Conflicts(conflicts.Proceed).
+		Script(&types.Script{
+			Source: "ctx._source.channelAncestors = params.ancestors; ctx._source.channelPath = params.path",
+			Params: map[string]json.RawMessage{
+				"ancestors": ancestors,
+				"path":      path,
+			},
+		}).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("reindex channel ancestry of %s in ES: %w", channelID, err)
+	}
+
+	return nil
+}
+
+// WatchChannelAncestries 一定間隔でSyncChannelAncestriesを実行する
+func (r *Repository) WatchChannelAncestries(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, nil, func() {
+		if err := r.SyncChannelAncestries(ctx); err != nil {
+			log.Printf("sync channel ancestries: %s", err)
+		}
+	})
+}
@@ -0,0 +1,398 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/anchor"
+)
+
+var (
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrRevisionNotFound = errors.New("revision not found")
+)
+
+type (
+	CommentThread struct {
+		ID     string `json:"id"`
+		NoteID string `json:"noteId"`
+		// Revision 範囲を指定したときのリビジョン．ノート全体へのコメントは空
+		Revision string `json:"revision,omitempty"`
+		// Anchor 最新リビジョンの本文中の範囲．ノート全体へのコメントはnil
+		Anchor *CommentAnchor `json:"anchor,omitempty"`
+		// Orphaned 本文の変更により範囲を追従できなくなった．Anchorは最後に追従できたリビジョンの範囲を指す
+		Orphaned   bool      `json:"orphaned"`
+		Resolved   bool      `json:"resolved"`
+		ResolvedBy string    `json:"resolvedBy,omitempty"`
+		ResolvedAt int32     `json:"resolvedAt,omitempty"`
+		CreatedBy  string    `json:"createdBy"`
+		CreatedAt  int32     `json:"createdAt"`
+		Comments   []Comment `json:"comments"`
+	}
+
+	CommentAnchor struct {
+		Revision string `json:"revision"`
+		Start    int    `json:"start"`
+		End      int    `json:"end"`
+		Quote    string `json:"quote"`
+	}
+
+	Comment struct {
+		ID        string `json:"id" db:"id"`
+		ThreadID  string `json:"-" db:"thread_id"`
+		Author    string `json:"author" db:"author"`
+		Body      string `json:"body" db:"body"`
+		CreatedAt int32  `json:"createdAt" db:"created_at"`
+	}
+
+	CreateCommentThreadParams struct {
+		NoteID   string
+		UserName string
+		Body     string
+		// Revision Start・Endが指すリビジョン．空の場合は最新リビジョン
+		Revision string
+		// Start, End 本文中の範囲．nilの場合はノート全体へのコメントにする
+		Start *int
+		End   *int
+	}
+
+	commentThreadRow struct {
+		ID               string         `db:"id"`
+		NoteID           string         `db:"note_id"`
+		RevisionID       sql.NullString `db:"revision_id"`
+		AnchorRevisionID sql.NullString `db:"anchor_revision_id"`
+		AnchorStart      sql.NullInt64  `db:"anchor_start"`
+		AnchorEnd        sql.NullInt64  `db:"anchor_end"`
+		Quote            sql.NullString `db:"quote"`
+		Orphaned         bool           `db:"orphaned"`
+		Resolved         bool           `db:"resolved"`
+		ResolvedBy       sql.NullString `db:"resolved_by"`
+		ResolvedAt       sql.NullInt32  `db:"resolved_at"`
+		CreatedBy        string         `db:"created_by"`
+		CreatedAt        int32          `db:"created_at"`
+	}
+)
+
+func (row commentThreadRow) thread() CommentThread {
+	t := CommentThread{
+		ID:         row.ID,
+		NoteID:     row.NoteID,
+		Revision:   row.RevisionID.String,
+		Orphaned:   row.Orphaned,
+		Resolved:   row.Resolved,
+		ResolvedBy: row.ResolvedBy.String,
+		ResolvedAt: row.ResolvedAt.Int32,
+		CreatedBy:  row.CreatedBy,
+		CreatedAt:  row.CreatedAt,
+		Comments:   []Comment{},
+	}
+	if row.AnchorStart.Valid && row.AnchorEnd.Valid {
+		t.Anchor = &CommentAnchor{
+			Revision: row.AnchorRevisionID.String,
+			Start:    int(row.AnchorStart.Int64),
+			End:      int(row.AnchorEnd.Int64),
+			Quote:    row.Quote.String,
+		}
+	}
+
+	return t
+}
+
+// getRevisionBody ノートのリビジョンの本文を取得する．revisionIDが空の場合は最新リビジョン
+func (r *Repository) getRevisionBody(_ context.Context, noteID string, revisionID string) (string, string, error) {
+	var row struct {
+		RevisionID string `db:"revision_id"`
+		Body       string `db:"body"`
+	}
+	var err error
+	if revisionID == "" {
+		err = r.db.Get(&row, `SELECT rev.revision_id, rev.body FROM note_revisions rev JOIN notes n ON n.latest_revision = rev.revision_id WHERE n.id = ?`, noteID)
+	} else {
+		err = r.db.Get(&row, `SELECT revision_id, body FROM note_revisions WHERE note_id = ? AND revision_id = ?`, noteID, revisionID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrRevisionNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("select note revision: %w", err)
+	}
+
+	return row.RevisionID, row.Body, nil
+}
+
+// CreateCommentThread ノートにコメントのスレッドを作る
+// 古いリビジョンの範囲を指定した場合は，最新リビジョンの範囲に追従させる
+func (r *Repository) CreateCommentThread(ctx context.Context, params CreateCommentThreadParams) (*CommentThread, error) {
+	if err := r.checkNoteReadable(ctx, params.NoteID, params.UserName); err != nil {
+		return nil, err
+	}
+
+	threadID, _ := uuid.NewV7()
+	now := time.Now().Unix()
+	row := commentThreadRow{
+		ID:        threadID.String(),
+		NoteID:    params.NoteID,
+		CreatedBy: params.UserName,
+		CreatedAt: int32(now),
+	}
+	if params.Start != nil && params.End != nil {
+		revisionID, body, err := r.getRevisionBody(ctx, params.NoteID, params.Revision)
+		if err != nil {
+			return nil, err
+		}
+		a, err := anchor.New(body, *params.Start, *params.End)
+		if err != nil {
+			return nil, err
+		}
+		latestID, latestBody, err := r.getRevisionBody(ctx, params.NoteID, "")
+		if err != nil {
+			return nil, err
+		}
+		anchorRevisionID := revisionID
+		if latestID != revisionID {
+			if moved, ok := anchor.Reanchor(body, latestBody, a); ok {
+				a, anchorRevisionID = moved, latestID
+			} else {
+				row.Orphaned = true
+			}
+		}
+		row.RevisionID = sql.NullString{String: revisionID, Valid: true}
+		row.AnchorRevisionID = sql.NullString{String: anchorRevisionID, Valid: true}
+		row.AnchorStart = sql.NullInt64{Int64: int64(a.Start), Valid: true}
+		row.AnchorEnd = sql.NullInt64{Int64: int64(a.End), Valid: true}
+		row.Quote = sql.NullString{String: a.Quote, Valid: true}
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO note_comment_threads (id, note_id, revision_id, anchor_revision_id, anchor_start, anchor_end, quote, orphaned, created_by, created_at)
+		VALUES (:id, :note_id, :revision_id, :anchor_revision_id, :anchor_start, :anchor_end, :quote, :orphaned, :created_by, :created_at)`
+	if _, err := tx.NamedExec(query, row); err != nil {
+		return nil, fmt.Errorf("insert comment thread: %w", err)
+	}
+	comment, err := insertComment(tx, row.ID, params.UserName, params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	thread := row.thread()
+	thread.Comments = append(thread.Comments, *comment)
+
+	return &thread, nil
+}
+
+func insertComment(db sqlx.Execer, threadID string, author string, body string) (*Comment, error) {
+	id, _ := uuid.NewV7()
+	comment := &Comment{
+		ID:        id.String(),
+		ThreadID:  threadID,
+		Author:    author,
+		Body:      body,
+		CreatedAt: int32(time.Now().Unix()),
+	}
+	query := `INSERT INTO note_comments (id, thread_id, author, body, created_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err := db.Exec(query, comment.ID, comment.ThreadID, comment.Author, comment.Body, comment.CreatedAt); err != nil {
+		return nil, fmt.Errorf("insert comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// getCommentThreadRow ユーザーが読めるノートのスレッドを取得する．削除されたノートのスレッドは見つからないものとする
+func (r *Repository) getCommentThreadRow(ctx context.Context, noteID string, threadID string, userName string) (*commentThreadRow, error) {
+	if err := r.checkNoteReadable(ctx, noteID, userName); err != nil {
+		return nil, err
+	}
+
+	var row commentThreadRow
+	query := `SELECT t.* FROM note_comment_threads t JOIN notes n ON n.id = t.note_id AND n.deleted_at IS NULL WHERE t.id = ? AND t.note_id = ?`
+	err := r.db.Get(&row, query, threadID, noteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select comment thread: %w", err)
+	}
+
+	return &row, nil
+}
+
+// ReplyComment スレッドに返信する．コメントがすべて削除されたスレッドには返信できない
+func (r *Repository) ReplyComment(ctx context.Context, noteID string, threadID string, userName string, body string) (*Comment, error) {
+	if _, err := r.getCommentThreadRow(ctx, noteID, threadID, userName); err != nil {
+		return nil, err
+	}
+	var active bool
+	query := `SELECT EXISTS(SELECT 1 FROM note_comments WHERE thread_id = ? AND deleted_at IS NULL)`
+	if err := r.db.QueryRow(query, threadID).Scan(&active); err != nil {
+		return nil, fmt.Errorf("select comments: %w", err)
+	}
+	if !active {
+		return nil, ErrCommentNotFound
+	}
+
+	return insertComment(r.db, threadID, userName, body)
+}
+
+// ResolveCommentThread スレッドを解決済みにする．resolvedがfalseの場合は未解決に戻す
+func (r *Repository) ResolveCommentThread(ctx context.Context, noteID string, threadID string, userName string, resolved bool) error {
+	if _, err := r.getCommentThreadRow(ctx, noteID, threadID, userName); err != nil {
+		return err
+	}
+
+	resolvedBy := sql.NullString{String: userName, Valid: resolved}
+	resolvedAt := sql.NullInt64{Int64: time.Now().Unix(), Valid: resolved}
+	query := `UPDATE note_comment_threads SET resolved = ?, resolved_by = ?, resolved_at = ? WHERE id = ?`
+	if _, err := r.db.Exec(query, resolved, resolvedBy, resolvedAt, threadID); err != nil {
+		return fmt.Errorf("update comment thread: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCommentThread スレッドをコメントごと削除する．スレッドを作ったユーザーのみ削除できる
+func (r *Repository) DeleteCommentThread(ctx context.Context, noteID string, threadID string, userName string) error {
+	row, err := r.getCommentThreadRow(ctx, noteID, threadID, userName)
+	if err != nil {
+		return err
+	}
+	if row.CreatedBy != userName {
+		return ErrForbidden
+	}
+
+	query := `UPDATE note_comments SET deleted_at = ? WHERE thread_id = ? AND deleted_at IS NULL`
+	if _, err := r.db.Exec(query, time.Now().Unix(), threadID); err != nil {
+		return fmt.Errorf("delete comments: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteComment コメントを削除する．コメントを書いたユーザーのみ削除できる
+// スレッドのコメントがすべて削除されると，スレッドも表示されなくなる
+func (r *Repository) DeleteComment(ctx context.Context, noteID string, threadID string, commentID string, userName string) error {
+	if _, err := r.getCommentThreadRow(ctx, noteID, threadID, userName); err != nil {
+		return err
+	}
+
+	var author string
+	query := `SELECT author FROM note_comments WHERE id = ? AND thread_id = ? AND deleted_at IS NULL`
+	err := r.db.QueryRow(query, commentID, threadID).Scan(&author)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCommentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("select comment: %w", err)
+	}
+	if author != userName {
+		return ErrForbidden
+	}
+
+	if _, err := r.db.Exec(`UPDATE note_comments SET deleted_at = ? WHERE id = ?`, time.Now().Unix(), commentID); err != nil {
+		return fmt.Errorf("delete comment: %w", err)
+	}
+
+	return nil
+}
+
+// GetCommentThreads ユーザーが読めるノートのスレッドを古い順に取得する．削除されていないコメントがないスレッドは含めない
+func (r *Repository) GetCommentThreads(ctx context.Context, noteID string, userName string) ([]CommentThread, error) {
+	if err := r.checkNoteReadable(ctx, noteID, userName); err != nil {
+		return nil, err
+	}
+
+	rows := []commentThreadRow{}
+	if err := r.db.Select(&rows, `SELECT * FROM note_comment_threads WHERE note_id = ? ORDER BY created_at, id`, noteID); err != nil {
+		return nil, fmt.Errorf("select comment threads: %w", err)
+	}
+	comments := []Comment{}
+	query := `SELECT c.id, c.thread_id, c.author, c.body, c.created_at FROM note_comments c JOIN note_comment_threads t ON t.id = c.thread_id
+		WHERE t.note_id = ? AND c.deleted_at IS NULL ORDER BY c.created_at, c.id`
+	if err := r.db.Select(&comments, query, noteID); err != nil {
+		return nil, fmt.Errorf("select comments: %w", err)
+	}
+
+	byThread := map[string][]Comment{}
+	for _, c := range comments {
+		byThread[c.ThreadID] = append(byThread[c.ThreadID], c)
+	}
+	threads := []CommentThread{}
+	for _, row := range rows {
+		if len(byThread[row.ID]) == 0 {
+			continue
+		}
+		thread := row.thread()
+		thread.Comments = byThread[row.ID]
+		threads = append(threads, thread)
+	}
+
+	return threads, nil
+}
+
+// reanchorComments ノートの本文が変わった場合に，範囲を指定したスレッドを新しい本文の範囲に追従させる
+// 追従できなかったスレッドは，最後に追従できた範囲を残したままorphanedにする
+func (r *Repository) reanchorComments(_ context.Context, noteID uuid.UUID, revisionID uuid.UUID, oldBody string, newBody string) {
+	rows := []commentThreadRow{}
+	query := `SELECT * FROM note_comment_threads WHERE note_id = ? AND anchor_start IS NOT NULL AND orphaned = FALSE`
+	if err := r.db.Select(&rows, query, noteID); err != nil {
+		log.Printf("failed to select comment threads to reanchor: %v", err)
+
+		return
+	}
+
+	for _, row := range rows {
+		a, ok := anchor.Reanchor(oldBody, newBody, anchor.Anchor{
+			Start: int(row.AnchorStart.Int64),
+			End:   int(row.AnchorEnd.Int64),
+			Quote: row.Quote.String,
+		})
+		var err error
+		if ok {
+			_, err = r.db.Exec(`UPDATE note_comment_threads SET anchor_revision_id = ?, anchor_start = ?, anchor_end = ? WHERE id = ?`, revisionID, a.Start, a.End, row.ID)
+		} else {
+			_, err = r.db.Exec(`UPDATE note_comment_threads SET orphaned = TRUE WHERE id = ?`, row.ID)
+		}
+		if err != nil {
+			log.Printf("failed to reanchor comment thread %s: %v", row.ID, err)
+		}
+	}
+}
+
+// countComments ノートごとの削除されていないコメント数を取得する
+func (r *Repository) countComments(_ context.Context, noteIDs []string) (map[string]int, error) {
+	counts := map[string]int{}
+	if len(noteIDs) == 0 {
+		return counts, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT t.note_id, COUNT(*) AS count FROM note_comments c JOIN note_comment_threads t ON t.id = c.thread_id
+		WHERE t.note_id IN (?) AND c.deleted_at IS NULL GROUP BY t.note_id`, noteIDs)
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	rows := []struct {
+		NoteID string `db:"note_id"`
+		Count  int    `db:"count"`
+	}{}
+	if err := r.db.Select(&rows, r.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("count comments: %w", err)
+	}
+	for _, row := range rows {
+		counts[row.NoteID] = row.Count
+	}
+
+	return counts, nil
+}
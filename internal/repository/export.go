@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/sortorder"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/notearchive"
+)
+
+// exportPageSize エクスポート時に一度にESから取得するノート数
+const exportPageSize = 500
+
+// exportedNoteDocument エクスポートに使うESのドキュメントの項目
+type exportedNoteDocument struct {
+	ID         string   `json:"id"`
+	Channel    string   `json:"channel"`
+	Permission string   `json:"permission"`
+	Title      string   `json:"title"`
+	Body       string   `json:"body"`
+	Tag        []string `json:"tag"`
+	CreatedAt  int64    `json:"createdAt"`
+	UpdatedAt  int64    `json:"updatedAt"`
+}
+
+type myFieldValue struct {
+	fieldValue types.FieldValue
+}
+
+func (v *myFieldValue) FieldValueCaster() *types.FieldValue {
+	return &v.fieldValue
+}
+
+// ExportNotes GetNotesと同じ条件に一致するノートを1件ずつfnに渡す
+// params.UserNameが一覧で読めるノートだけを含める．includeHistoryがtrueの場合はすべてのリビジョンも読み込む
+func (r *Repository) ExportNotes(ctx context.Context, params GetNotesParams, includeHistory bool, fn func(notearchive.Note) error) error {
+	params, err := r.withTagSynonyms(ctx, params)
+	if err != nil {
+		return err
+	}
+	query := &types.Query{
+		Bool: &types.BoolQuery{
+			Filter: []types.Query{*buildNotesQuery(params), listedNotesQuery(params.UserName)},
+		},
+	}
+	// ページをまたいでも順序が変わらないようにIDで同順位を解消する
+	sort := []types.SortCombinationsVariant{
+		&mySortCombinations{sortCombinations: types.SortOptions{SortOptions: map[string]types.FieldSort{"updatedAt": {Order: &sortorder.Desc}}}},
+		&mySortCombinations{sortCombinations: types.SortOptions{SortOptions: map[string]types.FieldSort{"id.keyword": {Order: &sortorder.Asc}}}},
+	}
+	channelPath := r.channelPathResolver(ctx)
+
+	var after []types.FieldValueVariant
+	for {
+		req := r.es.Search().Index("notes").Query(query).Sort(sort...).SourceExcludes_(attachmentsField).Size(exportPageSize)
+		if after != nil {
+			req = req.SearchAfter(after...)
+		}
+		res, err := req.Do(ctx)
+		if err != nil {
+			return searchError(fmt.Errorf("search notes in ES: %w", err))
+		}
+		if len(res.Hits.Hits) == 0 {
+			return nil
+		}
+
+		docs := make([]exportedNoteDocument, 0, len(res.Hits.Hits))
+		for _, hit := range res.Hits.Hits {
+			var doc exportedNoteDocument
+			if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+				return fmt.Errorf("unmarshal note data: %w", err)
+			}
+			docs = append(docs, doc)
+		}
+
+		revisions := map[string][]notearchive.Revision{}
+		if includeHistory {
+			revisions, err = r.exportRevisions(docs, channelPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, doc := range docs {
+			err := fn(notearchive.Note{
+				ID:          doc.ID,
+				Channel:     doc.Channel,
+				ChannelPath: channelPath(doc.Channel),
+				Permission:  doc.Permission,
+				Title:       doc.Title,
+				Body:        doc.Body,
+				Tags:        doc.Tag,
+				CreatedAt:   time.Unix(doc.CreatedAt, 0),
+				UpdatedAt:   time.Unix(doc.UpdatedAt, 0),
+				Revisions:   revisions[doc.ID],
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		last := res.Hits.Hits[len(res.Hits.Hits)-1]
+		after = make([]types.FieldValueVariant, 0, len(last.Sort))
+		for _, v := range last.Sort {
+			after = append(after, &myFieldValue{fieldValue: v})
+		}
+	}
+}
+
+// exportRevisions ノートごとのリビジョンを古い順に取得する
+func (r *Repository) exportRevisions(docs []exportedNoteDocument, channelPath func(string) string) (map[string][]notearchive.Revision, error) {
+	noteIDs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		noteIDs = append(noteIDs, doc.ID)
+	}
+
+	query, args, err := sqlx.In(`SELECT note_id, revision_id, channel, permission, title, body, updated_at FROM note_revisions WHERE note_id IN (?) ORDER BY updated_at, revision_id`, noteIDs)
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	rows := []struct {
+		NoteID     string `db:"note_id"`
+		RevisionID string `db:"revision_id"`
+		Channel    string `db:"channel"`
+		Permission string `db:"permission"`
+		Title      string `db:"title"`
+		Body       string `db:"body"`
+		UpdatedAt  int64  `db:"updated_at"`
+	}{}
+	if err := r.db.Select(&rows, r.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("select note revisions: %w", err)
+	}
+
+	revisions := map[string][]notearchive.Revision{}
+	for _, row := range rows {
+		revisions[row.NoteID] = append(revisions[row.NoteID], notearchive.Revision{
+			ID:          row.RevisionID,
+			Channel:     row.Channel,
+			ChannelPath: channelPath(row.Channel),
+			Permission:  row.Permission,
+			Title:       row.Title,
+			Body:        row.Body,
+			UpdatedAt:   time.Unix(row.UpdatedAt, 0),
+		})
+	}
+
+	return revisions, nil
+}
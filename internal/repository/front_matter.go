@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// front matterの値はキーごとに型別のフィールドに分けてESに登録する
+// 同じキーでもノートによって型が異なることがあるため，1つのフィールドにまとめると動的マッピングが衝突する
+const (
+	frontMatterField      = "frontMatter"
+	frontMatterTypeString = "string"
+	frontMatterTypeNumber = "number"
+	frontMatterTypeBool   = "bool"
+	frontMatterTypeDate   = "date"
+)
+
+// SetupNoteIndex front matterの型別のフィールド，添付ファイル，スターとピン留め，階層タグのマッピングをnotesインデックスに設定する
+// インデックスがなければ作成する．既にあるインデックスでは，階層タグを登録していないノートに登録する
+func (r *Repository) SetupNoteIndex(ctx context.Context) error {
+	properties := noteMarksMappings()
+	properties[attachmentsField] = attachmentsMapping()
+	properties[tagPathsField] = types.NewKeywordProperty()
+	templates := []map[string]types.DynamicTemplate{
+		{"front_matter_string": {PathMatch: []string{frontMatterField + ".*." + frontMatterTypeString}, Mapping: types.NewKeywordProperty()}},
+		{"front_matter_number": {PathMatch: []string{frontMatterField + ".*." + frontMatterTypeNumber}, Mapping: types.NewDoubleNumberProperty()}},
+		{"front_matter_bool": {PathMatch: []string{frontMatterField + ".*." + frontMatterTypeBool}, Mapping: types.NewBooleanProperty()}},
+		{"front_matter_date": {PathMatch: []string{frontMatterField + ".*." + frontMatterTypeDate}, Mapping: types.NewDateProperty()}},
+	}
+
+	exists, err := r.es.Indices.Exists("notes").IsSuccess(ctx)
+	if err != nil {
+		return fmt.Errorf("check notes index in ES: %w", err)
+	}
+	if !exists {
+		_, err := r.es.Indices.Create("notes").Mappings(&types.TypeMapping{DynamicTemplates: templates, Properties: properties}).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("create notes index in ES: %w", err)
+		}
+
+		return nil
+	}
+
+	if _, err := r.es.Indices.PutMapping("notes").DynamicTemplates(templates).Properties(properties).Do(ctx); err != nil {
+		return fmt.Errorf("put notes mapping in ES: %w", err)
+	}
+
+	return r.indexTagPaths(ctx)
+}
+
+// frontMatterFieldKey front matterのキーをESのフィールド名として使える形にする
+func frontMatterFieldKey(key string) string {
+	return strings.ReplaceAll(strings.TrimSpace(key), ".", "_")
+}
+
+// frontMatterDocument front matterをESに登録する型別のフィールドに変換する
+// 入れ子のmapは検索の対象にしない
+func frontMatterDocument(meta map[string]any) map[string]map[string][]any {
+	doc := map[string]map[string][]any{}
+	for key, value := range meta {
+		fieldKey := frontMatterFieldKey(key)
+		if fieldKey == "" {
+			continue
+		}
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			typ, indexed, ok := frontMatterValue(v)
+			if !ok {
+				continue
+			}
+			if doc[fieldKey] == nil {
+				doc[fieldKey] = map[string][]any{}
+			}
+			doc[fieldKey][typ] = append(doc[fieldKey][typ], indexed)
+		}
+	}
+
+	return doc
+}
+
+func frontMatterValue(v any) (string, any, bool) {
+	switch v := v.(type) {
+	case string:
+		return frontMatterTypeString, v, true
+	case bool:
+		return frontMatterTypeBool, v, true
+	case int:
+		return frontMatterTypeNumber, float64(v), true
+	case float64:
+		return frontMatterTypeNumber, v, true
+	case time.Time:
+		return frontMatterTypeDate, v.Format(time.RFC3339), true
+	}
+
+	return "", nil, false
+}
+
+// frontMatterQuery front matterのキーがvalueに一致するノートを絞り込むクエリ
+// valueは文字列として比較するほか，数値・真偽値・日付として解釈できる場合はその型のフィールドとも比較する
+// valueが空の場合はキーが存在するノートに一致する
+func frontMatterQuery(key string, value string) types.Query {
+	prefix := frontMatterField + "." + frontMatterFieldKey(key) + "."
+	if value == "" {
+		return types.Query{Exists: &types.ExistsQuery{Field: strings.TrimSuffix(prefix, ".")}}
+	}
+
+	should := []types.Query{NewTermQuery(prefix+frontMatterTypeString, value)}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		should = append(should, NewTermQuery(prefix+frontMatterTypeNumber, n))
+	}
+	if b, err := strconv.ParseBool(value); err == nil {
+		should = append(should, NewTermQuery(prefix+frontMatterTypeBool, b))
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			should = append(should, NewTermQuery(prefix+frontMatterTypeDate, t.Format(time.RFC3339)))
+
+			break
+		}
+	}
+
+	return types.Query{Bool: &types.BoolQuery{Should: should, MinimumShouldMatch: 1}}
+}
+
+// normalizeFrontMatter JSONとして保存できるように，YAMLの文字列以外のキーを持つmapを変換する
+func normalizeFrontMatter(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for key, value := range v {
+			res[key] = normalizeFrontMatter(value)
+		}
+
+		return res
+	case map[any]any:
+		res := make(map[string]any, len(v))
+		for key, value := range v {
+			res[fmt.Sprint(key)] = normalizeFrontMatter(value)
+		}
+
+		return res
+	case []any:
+		res := make([]any, len(v))
+		for i, value := range v {
+			res[i] = normalizeFrontMatter(value)
+		}
+
+		return res
+	}
+
+	return v
+}
+
+// marshalFrontMatter note_revisions.front_matterに保存する値を返す．front matterがない場合はNULLにする
+func marshalFrontMatter(meta map[string]any) (sql.NullString, error) {
+	if meta == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(normalizeFrontMatter(meta))
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("marshal front matter: %w", err)
+	}
+
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// getLatestFrontMatter ノートの最新リビジョンのfront matterを取得する
+func (r *Repository) getLatestFrontMatter(_ context.Context, noteID string) (map[string]any, error) {
+	var raw sql.NullString
+	query := `SELECT rev.front_matter FROM note_revisions rev JOIN notes n ON n.latest_revision = rev.revision_id WHERE n.id = ?`
+	err := r.db.QueryRow(query, noteID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !raw.Valid) {
+		return map[string]any{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select note front matter: %w", err)
+	}
+
+	meta := map[string]any{}
+	if err := json.Unmarshal([]byte(raw.String), &meta); err != nil {
+		return nil, fmt.Errorf("unmarshal note front matter: %w", err)
+	}
+
+	return meta, nil
+}
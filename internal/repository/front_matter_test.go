@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFrontMatterDocument(t *testing.T) {
+	meta := map[string]any{
+		"lang":        "ja",
+		"breaks":      false,
+		"version":     2,
+		"date":        time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		"tags":        []any{"a", 1},
+		"og.title":    "OGP",
+		"nested":      map[string]any{"x": 1},
+		"description": "説明",
+	}
+	b, err := json.Marshal(frontMatterDocument(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"breaks":{"bool":[false]},"date":{"date":["2024-04-01T00:00:00Z"]},"description":{"string":["説明"]},"lang":{"string":["ja"]},"og_title":{"string":["OGP"]},"tags":{"number":[1],"string":["a"]},"version":{"number":[2]}}`
+	if string(b) != want {
+		t.Errorf("frontMatterDocument() = %s, want %s", b, want)
+	}
+}
+
+func TestFrontMatterQuery(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		want  string
+	}{
+		{
+			key:   "lang",
+			value: "ja",
+			want:  `{"bool":{"minimum_should_match":1,"should":[{"term":{"frontMatter.lang.string":{"value":"ja"}}}]}}`,
+		},
+		{
+			key:   "version",
+			value: "2",
+			want:  `{"bool":{"minimum_should_match":1,"should":[{"term":{"frontMatter.version.string":{"value":"2"}}},{"term":{"frontMatter.version.number":{"value":2}}}]}}`,
+		},
+		{
+			key:   "breaks",
+			value: "true",
+			want:  `{"bool":{"minimum_should_match":1,"should":[{"term":{"frontMatter.breaks.string":{"value":"true"}}},{"term":{"frontMatter.breaks.bool":{"value":true}}}]}}`,
+		},
+		{
+			key:   "date",
+			value: "2024-04-01",
+			want:  `{"bool":{"minimum_should_match":1,"should":[{"term":{"frontMatter.date.string":{"value":"2024-04-01"}}},{"term":{"frontMatter.date.date":{"value":"2024-04-01T00:00:00Z"}}}]}}`,
+		},
+		{
+			key:   "og.title",
+			value: "",
+			want:  `{"exists":{"field":"frontMatter.og_title"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			b, err := json.Marshal(frontMatterQuery(tt.key, tt.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("frontMatterQuery(%q, %q) = %s, want %s", tt.key, tt.value, b, tt.want)
+			}
+		})
+	}
+}
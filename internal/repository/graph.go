@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/notegraph"
+)
+
+// MaxGraphNotes グラフに含めるノート数の上限
+const MaxGraphNotes = 1000
+
+// graphNoteDocument グラフに使うESのドキュメントの項目
+type graphNoteDocument struct {
+	ID      string   `json:"id"`
+	Channel string   `json:"channel"`
+	Title   string   `json:"title"`
+	Tag     []string `json:"tag"`
+}
+
+// GetGraph GetNotesと同じ条件に一致するノートと，そのタグ・チャンネルをグラフにする
+// publicなノートと，ログイン中の場合はlimitedなノートだけを含める．ノート間のリンクは両端のノートがグラフに含まれる場合のみ辺にする
+// 条件に一致するノートの総数も返す
+func (r *Repository) GetGraph(ctx context.Context, params GetNotesParams) (*notegraph.Graph, int64, error) {
+	params, err := r.withTagSynonyms(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	query := &types.Query{
+		Bool: &types.BoolQuery{
+			Filter: []types.Query{*buildNotesQuery(params), listedNotesQuery(params.UserName)},
+		},
+	}
+	sort, err := notesSort(params.SortKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	countRes, err := r.es.Count().Index("notes").Query(query).Do(ctx)
+	if err != nil {
+		return nil, 0, searchError(fmt.Errorf("count notes in ES: %w", err))
+	}
+
+	res, err := r.es.Search().Index("notes").Query(query).Sort(sort...).
+		Source_(&types.SourceFilter{Includes: []string{"id", "channel", "title", "tag"}}).
+		Size(min(params.Limit, MaxGraphNotes)).From(params.Offset).Do(ctx)
+	if err != nil {
+		return nil, 0, searchError(fmt.Errorf("search notes in ES: %w", err))
+	}
+
+	g := notegraph.New()
+	channelPath := r.channelPathResolver(ctx)
+	noteIDs := make([]string, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		var doc graphNoteDocument
+		if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+			return nil, 0, fmt.Errorf("unmarshal note data: %w", err)
+		}
+		noteIDs = append(noteIDs, doc.ID)
+
+		note := g.AddNode(notegraph.Node{ID: notegraph.NoteID(doc.ID), Type: notegraph.NodeNote, Label: doc.Title})
+		if doc.Channel != "" {
+			channel := g.AddNode(notegraph.Node{ID: notegraph.ChannelID(doc.Channel), Type: notegraph.NodeChannel, Label: channelPath(doc.Channel)})
+			g.AddEdge(notegraph.Edge{Source: note, Target: channel, Type: notegraph.EdgeChannel})
+		}
+		for _, name := range doc.Tag {
+			tag := g.AddNode(notegraph.Node{ID: notegraph.TagID(name), Type: notegraph.NodeTag, Label: name})
+			g.AddEdge(notegraph.Edge{Source: note, Target: tag, Type: notegraph.EdgeTag})
+		}
+	}
+
+	if err := r.addGraphLinks(g, noteIDs); err != nil {
+		return nil, 0, err
+	}
+
+	return g, countRes.Count, nil
+}
+
+// addGraphLinks グラフに含まれるノート間のリンクを辺として追加する
+func (r *Repository) addGraphLinks(g *notegraph.Graph, noteIDs []string) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(`SELECT DISTINCT source_note_id, target_note_id FROM note_links WHERE source_note_id IN (?) AND target_note_id IN (?) AND broken = FALSE ORDER BY source_note_id, target_note_id`, noteIDs, noteIDs)
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+	rows := []struct {
+		SourceNoteID string `db:"source_note_id"`
+		TargetNoteID string `db:"target_note_id"`
+	}{}
+	if err := r.db.Select(&rows, r.db.Rebind(query), args...); err != nil {
+		return fmt.Errorf("select note links: %w", err)
+	}
+
+	for _, row := range rows {
+		g.AddEdge(notegraph.Edge{
+			Source: notegraph.NoteID(row.SourceNoteID),
+			Target: notegraph.NoteID(row.TargetNoteID),
+			Type:   notegraph.EdgeLink,
+		})
+	}
+
+	return nil
+}
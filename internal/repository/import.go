@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"github.com/traP-jp/circuledge-backend/internal/noterender"
+)
+
+type (
+	ImportNoteParams struct {
+		// Source 取り込み元の種類．SourceIDと組み合わせて重複取り込みを防ぐ
+		Source     string
+		SourceID   string
+		Channel    uuid.UUID
+		Permission string
+		Body       string
+		// Title 空でない場合，本文から導出したタイトルの代わりに使う
+		Title     string
+		Tags      []string
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	ImportNoteResult struct {
+		SourceID string
+		NoteID   uuid.UUID
+		// Skipped 取り込み済みのためスキップした
+		Skipped bool
+		Err     error
+	}
+)
+
+// ImportNotes 外部のノートを作成日時・更新日時を保ったまま一括で取り込む
+// 取り込み済みのノートはスキップするため，同じ入力で何度実行してもノートは重複しない
+func (r *Repository) ImportNotes(ctx context.Context, notes []ImportNoteParams) ([]ImportNoteResult, error) {
+	results := make([]ImportNoteResult, len(notes))
+	if len(notes) == 0 {
+		return results, nil
+	}
+
+	imported, err := r.importedNotes(notes)
+	if err != nil {
+		return nil, err
+	}
+	ancestries, err := r.fetchChannelAncestries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resolveChannel := r.channelIDResolver(ctx)
+
+	docs := map[int]map[string]any{}
+	for i, note := range notes {
+		results[i].SourceID = note.SourceID
+		if noteID, ok := imported[note.Source+"\x00"+note.SourceID]; ok {
+			results[i].NoteID = noteID
+			results[i].Skipped = true
+
+			continue
+		}
+
+		noteID, _ := uuid.NewV7()
+		revisionID, _ := uuid.NewV7()
+		results[i].NoteID = noteID
+
+		body := note.Body
+		references := notebody.ExtractReferences(body, resolveChannel)
+		metadata := noterender.ExtractMetadata(body)
+		frontMatter, _, err := notebody.SplitFrontMatter(body)
+		if err != nil {
+			frontMatter = nil
+		}
+		if note.Title != "" {
+			metadata.Title = note.Title
+		}
+		for _, tag := range note.Tags {
+			if !slices.Contains(metadata.Tags, tag) {
+				metadata.Tags = append(metadata.Tags, tag)
+			}
+		}
+		ancestry, ok := ancestries[note.Channel.String()]
+		if !ok {
+			ancestry = channelAncestry{Ancestors: []string{note.Channel.String()}}
+		}
+
+		if err := r.insertImportedNote(noteID, revisionID, note, metadata, body, frontMatter, references); err != nil {
+			results[i].Err = err
+
+			continue
+		}
+		docs[i] = map[string]any{
+			"id":               noteID.String(),
+			"latestRevision":   revisionID.String(),
+			"channel":          note.Channel.String(),
+			"channelAncestors": ancestry.Ancestors,
+			"channelPath":      ancestry.Path,
+			"permission":       note.Permission,
+			"title":            metadata.Title,
+			"summary":          metadata.Summary,
+			"body":             body,
+			"plainText":        noterender.PlainText(body),
+			"tag":              metadata.Tags,
+			"tagPaths":         tagPaths(metadata.Tags),
+			"mentions":         notebody.MentionedUsers(references),
+			"frontMatter":      frontMatterDocument(frontMatter),
+			"createdAt":        note.CreatedAt.Unix(),
+			"updatedAt":        note.UpdatedAt.Unix(),
+		}
+	}
+
+	if err := r.indexImportedNotes(ctx, results, docs); err != nil {
+		return nil, err
+	}
+	r.linkImportedNotes(ctx, results, docs)
+
+	return results, nil
+}
+
+// importedNotes 取り込み済みのノートを「source\x00source_id」をキーとして返す
+func (r *Repository) importedNotes(notes []ImportNoteParams) (map[string]uuid.UUID, error) {
+	bySource := map[string][]string{}
+	for _, note := range notes {
+		bySource[note.Source] = append(bySource[note.Source], note.SourceID)
+	}
+
+	imported := map[string]uuid.UUID{}
+	for source, sourceIDs := range bySource {
+		query, args, err := sqlx.In(`SELECT source_id, note_id FROM note_import_sources WHERE source = ? AND source_id IN (?)`, source, sourceIDs)
+		if err != nil {
+			return nil, fmt.Errorf("build query: %w", err)
+		}
+		rows := []struct {
+			SourceID string    `db:"source_id"`
+			NoteID   uuid.UUID `db:"note_id"`
+		}{}
+		if err := r.db.Select(&rows, r.db.Rebind(query), args...); err != nil {
+			return nil, fmt.Errorf("select imported notes: %w", err)
+		}
+		for _, row := range rows {
+			imported[source+"\x00"+row.SourceID] = row.NoteID
+		}
+	}
+
+	return imported, nil
+}
+
+// insertImportedNote ノート・リビジョン・取り込み元を1つのトランザクションで書き込む
+func (r *Repository) insertImportedNote(noteID uuid.UUID, revisionID uuid.UUID, note ImportNoteParams, metadata noterender.Metadata, body string, frontMatter map[string]any, references []notebody.Reference) error {
+	frontMatterJSON, err := marshalFrontMatter(frontMatter)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO notes (id, latest_revision, created_at, deleted_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(query, noteID, revisionID, note.CreatedAt.Unix(), nil, note.UpdatedAt.Unix()); err != nil {
+		return fmt.Errorf("insert note: %w", err)
+	}
+
+	query = `INSERT INTO note_revisions (note_id, revision_id, channel, permission, title, summary, body, front_matter, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(query, noteID, revisionID, note.Channel, note.Permission, metadata.Title, metadata.Summary, body, frontMatterJSON, note.UpdatedAt.Unix()); err != nil {
+		return fmt.Errorf("insert note revision: %w", err)
+	}
+
+	query = `INSERT IGNORE INTO note_revision_references (revision_id, note_id, type, target_id, raw) VALUES (?, ?, ?, ?, ?)`
+	for _, ref := range references {
+		targetID := sql.NullString{String: ref.ID, Valid: ref.ID != ""}
+		if _, err := tx.Exec(query, revisionID, noteID, ref.Type, targetID, truncateRunes(ref.Raw, maxReferenceRawLength)); err != nil {
+			return fmt.Errorf("insert note revision reference: %w", err)
+		}
+	}
+
+	query = `INSERT INTO note_import_sources (source, source_id, note_id, imported_at) VALUES (?, ?, ?, ?)`
+	if _, err := tx.Exec(query, note.Source, note.SourceID, noteID, time.Now().Unix()); err != nil {
+		return fmt.Errorf("insert note import source: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// indexImportedNotes 取り込んだノートをESに一括で登録する
+// 登録に失敗したノートはMySQLからも削除し，次回の実行で取り込み直されるようにする
+func (r *Repository) indexImportedNotes(ctx context.Context, results []ImportNoteResult, docs map[int]map[string]any) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	bulk := r.es.Bulk().Index("notes")
+	order := make([]int, 0, len(docs))
+	for i := range results {
+		doc, ok := docs[i]
+		if !ok {
+			continue
+		}
+		if err := bulk.IndexOp(types.IndexOperation{Id_: some.String(results[i].NoteID.String())}, doc); err != nil {
+			return fmt.Errorf("build bulk request: %w", err)
+		}
+		order = append(order, i)
+	}
+
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		for _, i := range order {
+			results[i].Err = fmt.Errorf("index note in ES: %w", err)
+			r.deleteImportedNote(results[i].NoteID)
+		}
+
+		return nil
+	}
+
+	for j, item := range res.Items {
+		i := order[j]
+		for _, resItem := range item {
+			if resItem.Error == nil {
+				continue
+			}
+			reason := ""
+			if resItem.Error.Reason != nil {
+				reason = *resItem.Error.Reason
+			}
+			results[i].Err = fmt.Errorf("index note in ES: %s", reason)
+			r.deleteImportedNote(results[i].NoteID)
+		}
+	}
+
+	return nil
+}
+
+// linkImportedNotes 取り込んだノートの本文中のリンクを記録する
+// 取り込んだノートどうしのリンクも解決できるように，すべてのノートを登録した後に行う
+func (r *Repository) linkImportedNotes(ctx context.Context, results []ImportNoteResult, docs map[int]map[string]any) {
+	for i, doc := range docs {
+		if results[i].Err != nil {
+			continue
+		}
+		if err := r.resolveTitleLinks(ctx, results[i].NoteID, doc["title"].(string)); err != nil {
+			log.Printf("failed to resolve links to imported note %s: %v", results[i].NoteID, err)
+		}
+	}
+	for i, doc := range docs {
+		if results[i].Err != nil {
+			continue
+		}
+		revisionID, _ := uuid.Parse(doc["latestRevision"].(string))
+		if err := r.updateNoteLinks(ctx, results[i].NoteID, revisionID, doc["body"].(string)); err != nil {
+			log.Printf("failed to update links of imported note %s: %v", results[i].NoteID, err)
+		}
+	}
+}
+
+func (r *Repository) deleteImportedNote(noteID uuid.UUID) {
+	if _, err := r.db.Exec(`DELETE FROM note_import_sources WHERE note_id = ?`, noteID); err != nil {
+		log.Printf("DB Error: %s", err)
+	}
+	// note_revisionsとnote_revision_referencesは外部キー制約により削除される
+	if _, err := r.db.Exec(`DELETE FROM notes WHERE id = ?`, noteID); err != nil {
+		log.Printf("DB Error: %s", err)
+	}
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+)
+
+// maxLinkFieldLength note_links.rawとtarget_titleに保存する最大文字数
+const maxLinkFieldLength = 255
+
+var ErrNoteNotFound = errors.New("note not found")
+
+type (
+	// NoteLink ノートの本文中にある他のノートへのリンク
+	NoteLink struct {
+		Raw string `json:"raw"`
+		// TargetTitle `[[タイトル]]`の形式で書かれた場合のタイトル
+		TargetTitle string `json:"targetTitle,omitempty"`
+		// TargetNoteID リンク先のノート．タイトルに一致するノートがない場合は空
+		TargetNoteID string `json:"targetNoteId,omitempty"`
+		// Title リンク先のノートの現在のタイトル．リンク先が壊れているか，一覧に含めない権限の場合は空
+		Title  string `json:"title,omitempty"`
+		Broken bool   `json:"broken"`
+	}
+
+	// Backlink ノートにリンクしているノート
+	Backlink struct {
+		ID          string `json:"id" db:"id"`
+		Channel     string `json:"channel" db:"channel"`
+		ChannelPath string `json:"channelPath,omitempty" db:"-"`
+		Permission  string `json:"permission" db:"permission"`
+		Title       string `json:"title" db:"title"`
+		Summary     string `json:"summary" db:"summary"`
+		UpdatedAt   int32  `json:"updatedAt" db:"updated_at"`
+	}
+)
+
+// updateNoteLinks リビジョンの本文から他のノートへのリンクを取り出し，ノートのリンクを置き換える
+func (r *Repository) updateNoteLinks(ctx context.Context, noteID uuid.UUID, revisionID uuid.UUID, body string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := r.replaceNoteLinks(ctx, tx, noteID, revisionID, body); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// replaceNoteLinks ノートのリンクをリビジョンの本文中のリンクに置き換える
+func (r *Repository) replaceNoteLinks(ctx context.Context, db sqlx.Execer, noteID uuid.UUID, revisionID uuid.UUID, body string) error {
+	links := notebody.ExtractLinks(body)
+
+	if _, err := db.Exec(`DELETE FROM note_links WHERE source_note_id = ?`, noteID); err != nil {
+		return fmt.Errorf("delete note links: %w", err)
+	}
+
+	query := `INSERT INTO note_links (source_note_id, position, revision_id, raw, target_title, target_note_id, broken) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	for i, link := range links {
+		targetID, broken, err := r.resolveLink(ctx, link)
+		if err != nil {
+			return err
+		}
+		targetTitle := sql.NullString{String: truncateRunes(link.Title, maxLinkFieldLength), Valid: link.Title != ""}
+		if _, err := db.Exec(query, noteID, i, revisionID, truncateRunes(link.Raw, maxLinkFieldLength), targetTitle, targetID, broken); err != nil {
+			return fmt.Errorf("insert note link: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// resolveLink リンク先のノートIDと，リンクが壊れているかどうかを返す
+// `[[タイトル]]`は最新リビジョンのタイトルが一致するノートのうち，最も新しく更新されたものに解決する
+func (r *Repository) resolveLink(_ context.Context, link notebody.Link) (sql.NullString, bool, error) {
+	if link.NoteID != "" {
+		var count int
+		err := r.db.QueryRow(`SELECT COUNT(*) FROM notes WHERE id = ? AND deleted_at IS NULL`, link.NoteID).Scan(&count)
+		if err != nil {
+			return sql.NullString{}, false, fmt.Errorf("select linked note: %w", err)
+		}
+
+		return sql.NullString{String: link.NoteID, Valid: true}, count == 0, nil
+	}
+
+	var id string
+	query := `SELECT n.id FROM notes n JOIN note_revisions rev ON rev.revision_id = n.latest_revision WHERE rev.title = ? AND n.deleted_at IS NULL ORDER BY n.updated_at DESC LIMIT 1`
+	err := r.db.QueryRow(query, link.Title).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.NullString{}, true, nil
+	}
+	if err != nil {
+		return sql.NullString{}, false, fmt.Errorf("select note by title: %w", err)
+	}
+
+	return sql.NullString{String: id, Valid: true}, false, nil
+}
+
+// resolveTitleLinks タイトルに一致するノートがなかった`[[タイトル]]`のリンクを，そのタイトルになったノートに向ける
+func (r *Repository) resolveTitleLinks(_ context.Context, noteID uuid.UUID, title string) error {
+	query := `UPDATE note_links SET target_note_id = ?, broken = FALSE WHERE target_title = ? AND broken = TRUE`
+	if _, err := r.db.Exec(query, noteID, truncateRunes(title, maxLinkFieldLength)); err != nil {
+		return fmt.Errorf("resolve note links by title: %w", err)
+	}
+
+	return nil
+}
+
+// breakNoteLinks 削除されたノートへのリンクを壊れたリンクにする
+func (r *Repository) breakNoteLinks(_ context.Context, noteID string) error {
+	if _, err := r.db.Exec(`UPDATE note_links SET broken = TRUE WHERE target_note_id = ?`, noteID); err != nil {
+		return fmt.Errorf("break note links: %w", err)
+	}
+
+	return nil
+}
+
+// retitleNoteLinks ノートのタイトルが変わった場合に，リンク元の本文の`[[旧タイトル]]`を`[[新タイトル]]`に書き換える
+// リンク元ごとに新しいリビジョンを作る．書き換えに失敗したリンク元はログに残して次に進む
+func (r *Repository) retitleNoteLinks(ctx context.Context, noteID uuid.UUID, oldTitle string, newTitle string) {
+	sourceIDs := []string{}
+	query := `SELECT DISTINCT source_note_id FROM note_links WHERE target_note_id = ? AND target_title = ? AND source_note_id <> ?`
+	if err := r.db.Select(&sourceIDs, query, noteID, truncateRunes(oldTitle, maxLinkFieldLength), noteID); err != nil {
+		log.Printf("failed to select note links to retitle: %v", err)
+
+		return
+	}
+
+	for _, sourceID := range sourceIDs {
+		if err := r.retitleSourceNote(ctx, sourceID, oldTitle, newTitle); err != nil {
+			log.Printf("failed to retitle links in note %s: %v", sourceID, err)
+		}
+	}
+}
+
+func (r *Repository) retitleSourceNote(ctx context.Context, sourceID string, oldTitle string, newTitle string) error {
+	note, err := r.getNoteDocument(ctx, sourceID)
+	if err != nil {
+		return err
+	}
+	body := notebody.RetitleWikiLinks(note.Body, oldTitle, newTitle)
+	if body == note.Body {
+		return nil
+	}
+
+	noteID, err := uuid.Parse(sourceID)
+	if err != nil {
+		return fmt.Errorf("parse note ID: %w", err)
+	}
+	channelID, _ := uuid.Parse(note.Channel)
+	revisionID, _ := uuid.Parse(note.LatestRevision)
+
+	return r.UpdateNote(ctx, noteID, UpdateNoteParams{
+		Channel:    channelID,
+		Permission: note.Permission,
+		Revision:   revisionID,
+		Body:       body,
+	})
+}
+
+// noteExists 削除されていないノートが存在するかどうか
+func (r *Repository) noteExists(_ context.Context, noteID string) (bool, error) {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM notes WHERE id = ? AND deleted_at IS NULL`, noteID).Scan(&count); err != nil {
+		return false, fmt.Errorf("select note: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// GetNoteLinks ノートの最新リビジョンの本文中にある他のノートへのリンクを本文中の順に取得する
+// ユーザーが読めないノートの場合はErrNoteNotFoundを返す．一覧に含めない権限のノートへのリンクはタイトルを返さない
+func (r *Repository) GetNoteLinks(ctx context.Context, noteID string, userName string) ([]NoteLink, error) {
+	if err := r.checkNoteReadable(ctx, noteID, userName); err != nil {
+		return nil, err
+	}
+
+	rows := []struct {
+		Raw          string         `db:"raw"`
+		TargetTitle  sql.NullString `db:"target_title"`
+		TargetNoteID sql.NullString `db:"target_note_id"`
+		Title        sql.NullString `db:"title"`
+		Broken       bool           `db:"broken"`
+	}{}
+	query, args, err := sqlx.In(`SELECT l.raw, l.target_title, l.target_note_id, IF(l.broken OR rev.permission NOT IN (?), NULL, rev.title) AS title, l.broken
+		FROM note_links l
+		LEFT JOIN notes n ON n.id = l.target_note_id
+		LEFT JOIN note_revisions rev ON rev.revision_id = n.latest_revision
+		WHERE l.source_note_id = ?
+		ORDER BY l.position`, listedPermissions(userName), noteID)
+	if err != nil {
+		return nil, fmt.Errorf("build note links query: %w", err)
+	}
+	if err := r.db.Select(&rows, query, args...); err != nil {
+		return nil, fmt.Errorf("select note links: %w", err)
+	}
+
+	links := make([]NoteLink, 0, len(rows))
+	for _, row := range rows {
+		links = append(links, NoteLink{
+			Raw:          row.Raw,
+			TargetTitle:  row.TargetTitle.String,
+			TargetNoteID: row.TargetNoteID.String,
+			Title:        row.Title.String,
+			Broken:       row.Broken,
+		})
+	}
+
+	return links, nil
+}
+
+// GetNoteBacklinks ノートにリンクしているノートを新しく更新された順に取得する
+// ユーザーが読めないノートの場合はErrNoteNotFoundを返す．削除されたノートと一覧に含めない権限のノートは含めない
+func (r *Repository) GetNoteBacklinks(ctx context.Context, noteID string, userName string) ([]Backlink, error) {
+	if err := r.checkNoteReadable(ctx, noteID, userName); err != nil {
+		return nil, err
+	}
+
+	backlinks := []Backlink{}
+	query, args, err := sqlx.In(`SELECT DISTINCT n.id, rev.channel, rev.permission, rev.title, rev.summary, n.updated_at
+		FROM note_links l
+		JOIN notes n ON n.id = l.source_note_id
+		JOIN note_revisions rev ON rev.revision_id = n.latest_revision
+		WHERE l.target_note_id = ? AND n.deleted_at IS NULL AND rev.permission IN (?)
+		ORDER BY n.updated_at DESC`, noteID, listedPermissions(userName))
+	if err != nil {
+		return nil, fmt.Errorf("build note backlinks query: %w", err)
+	}
+	if err := r.db.Select(&backlinks, query, args...); err != nil {
+		return nil, fmt.Errorf("select note backlinks: %w", err)
+	}
+
+	channelPath := r.channelPathResolver(ctx)
+	for i := range backlinks {
+		backlinks[i].ChannelPath = channelPath(backlinks[i].Channel)
+	}
+
+	return backlinks, nil
+}
@@ -4,17 +4,22 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
-	"strings"
+	"slices"
 	"time"
 
+	"github.com/elastic/go-elasticsearch/v9/typedapi/some"
 	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
 	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/sortorder"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	traq "github.com/traPtitech/go-traq"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"github.com/traP-jp/circuledge-backend/internal/noterender"
+	"github.com/traP-jp/circuledge-backend/internal/searchpattern"
 )
 
 type (
@@ -50,18 +55,42 @@ type (
 	}
 
 	NoteResponse struct {
-		Revision       string    `json:"revision"`
-		Channel        string    `json:"channel"`
-		Permission     string    `json:"permission"`
-		Body           string    `json:"body"`
-		ID             uuid.UUID `json:"id,omitempty" db:"id"`
-		LatestRevision uuid.UUID `json:"latest_revision,omitempty" db:"latest_revision"`
-		CreatedAt      int32     `json:"created_at,omitempty" db:"created_at"`
-		DeletedAt      int32     `json:"deleted_at,omitempty" db:"deleted_at"`
-		UpdatedAt      int32     `json:"updated_at,omitempty" db:"updated_at"`
+		Revision       string               `json:"revision"`
+		References     []notebody.Reference `json:"references"`
+		FrontMatter    map[string]any       `json:"frontMatter"`
+		Channel        string               `json:"channel"`
+		ChannelPath    string               `json:"channelPath"`
+		Permission     string               `json:"permission"`
+		Title          string               `json:"title,omitempty"`
+		Tags           []string             `json:"tags,omitempty"`
+		Body           string               `json:"body"`
+		ID             uuid.UUID            `json:"id,omitempty" db:"id"`
+		LatestRevision uuid.UUID            `json:"latest_revision,omitempty" db:"latest_revision"`
+		CreatedAt      int32                `json:"created_at,omitempty" db:"created_at"`
+		DeletedAt      int32                `json:"deleted_at,omitempty" db:"deleted_at"`
+		UpdatedAt      int32                `json:"updated_at,omitempty" db:"updated_at"`
+	}
+
+	CreateNoteParams struct {
+		// UserName 作成したユーザーのtraQ ID．告知設定の参照に使う
+		UserName string
+		Channel  uuid.UUID
+		// Permission 空の場合はlimitedにする
+		Permission string
+		// Tags 本文から導出したタグに加えるタグ
+		Tags []string
+		// Title 空でない場合，本文から導出したタイトルの代わりに使う
+		Title string
+		Body  string
+		// Template nilでない場合，テンプレートを展開したタイトルと本文をTitleとBodyの代わりに使う
+		Template *RenderTemplateParams
 	}
 
 	UpdateNoteParams struct {
+		// UserName 更新したユーザーのtraQ ID．告知設定の参照に使う
+		UserName string `json:"-" db:"-"`
+		// Notify nilでない場合，このノートをtraQに告知するかどうかを更新する
+		Notify     *bool     `json:"-" db:"-"`
 		Channel    uuid.UUID `json:"channel,omitempty" db:"channel"`
 		Permission string    `json:"permission,omitempty" db:"permission"`
 		Revision   uuid.UUID `json:"revision,omitempty" db:"revision"`
@@ -83,11 +112,12 @@ type (
 	}
 
 	GetNoteHistoryResponse struct {
-		RevisionID uuid.UUID `json:"revision_id,omitempty" db:"revision_id"`
-		Channel    uuid.UUID `json:"channel,omitempty" db:"channel"`
-		Permission string    `json:"permission,omitempty" db:"permission"`
-		UpdatedAt  int32     `json:"updated_at,omitempty" db:"updated_at"`
-		Body       string    `json:"body,omitempty" db:"body"`
+		RevisionID  uuid.UUID `json:"revision_id,omitempty" db:"revision_id"`
+		Channel     uuid.UUID `json:"channel,omitempty" db:"channel"`
+		ChannelPath string    `json:"channelPath,omitempty" db:"-"`
+		Permission  string    `json:"permission,omitempty" db:"permission"`
+		UpdatedAt   int32     `json:"updated_at,omitempty" db:"updated_at"`
+		Body        string    `json:"body,omitempty" db:"body"`
 	}
 	UserSetting struct {
 		UserName       string    `json:"user_name,omitempty" db:"user_name"`
@@ -98,21 +128,49 @@ type (
 		Channel      string `json:"channel"`
 		IncludeChild bool   `json:"includeChild"`
 		Tags         []string
-		Title        string `json:"title"`
-		Body         string `json:"body"`
-		SortKey      string `json:"sortKey"`
-		Limit        int    `json:"limit"`
-		Offset       int    `json:"offset"`
+		// TagSynonyms タグごとの同義語．リポジトリが検索時に設定する
+		TagSynonyms map[string][]string `json:"-"`
+		Title       string              `json:"title"`
+		Body        string              `json:"body"`
+		// Mode title・body・tagの検索モード．空の場合はliteralとして扱う
+		Mode string `json:"mode"`
+		// Op title・body・tagの条件の組み合わせ方．空の場合はandとして扱う
+		Op string `json:"op"`
+		// NotTags これらのタグが付いたノートを除く
+		NotTags []string `json:"notTags"`
+		// NotChannels これらのチャンネルとその子孫チャンネルのノートを除く．IncludeChildには影響されない
+		NotChannels []string `json:"notChannels"`
+		// MentionedUser 空でない場合，このユーザーへのメンションを含むノートに絞り込む
+		MentionedUser string `json:"mentionedUser"`
+		// StarredBy 空でない場合，このユーザーがスターを付けたノートに絞り込む
+		StarredBy string `json:"starredBy"`
+		// UserName リクエストしたユーザーのtraQ ID．ログインしていない場合は空にする．starredの判定にも使う
+		UserName string `json:"-"`
+		// FrontMatter front matterのキーと値で絞り込む．値が空の場合はキーが存在するノートに絞り込む
+		FrontMatter map[string][]string `json:"frontMatter"`
+		SortKey     string              `json:"sortKey"`
+		Limit       int                 `json:"limit"`
+		Offset      int                 `json:"offset"`
 	}
 	GetNotesResponse struct {
-		ID         string   `json:"id,omitempty" db:"id"`
-		Channel    string   `json:"channel,omitempty" db:"channel"`
-		Permission string   `json:"permission,omitempty" db:"permission"`
-		Title      string   `json:"title,omitempty" db:"title"`
-		Summary    string   `json:"summary,omitempty" db:"summary"`
-		Tag        []string `json:"tag,omitempty" db:"tag"`
-		UpdatedAt  int32    `json:"updatedAt,omitempty" db:"updated_at"`
-		CreatedAt  int32    `json:"createdAt,omitempty" db:"created_at"`
+		ID          string   `json:"id,omitempty" db:"id"`
+		Channel     string   `json:"channel,omitempty" db:"channel"`
+		ChannelPath string   `json:"channelPath,omitempty" db:"-"`
+		Permission  string   `json:"permission,omitempty" db:"permission"`
+		Title       string   `json:"title,omitempty" db:"title"`
+		Summary     string   `json:"summary,omitempty" db:"summary"`
+		Tag         []string `json:"tag,omitempty" db:"tag"`
+		UpdatedAt   int32    `json:"updatedAt,omitempty" db:"updated_at"`
+		CreatedAt   int32    `json:"createdAt,omitempty" db:"created_at"`
+		// CommentCount 削除されていないコメントの数
+		CommentCount int `json:"commentCount" db:"-"`
+		StarCount    int `json:"starCount" db:"-"`
+		// Starred リクエストしたユーザーがスターを付けているかどうか
+		Starred bool `json:"starred" db:"-"`
+		// Pinned 絞り込んだチャンネル（指定がない場合はノートのチャンネル）にピン留めされているかどうか
+		Pinned bool `json:"pinned" db:"-"`
+		// MatchedAttachments 本文の検索語に一致した添付ファイル
+		MatchedAttachments []MatchedAttachment `json:"matchedAttachments,omitempty" db:"-"`
 	}
 )
 
@@ -137,11 +195,23 @@ func (r *Repository) GetNote(ctx context.Context, noteID string) (*NoteResponse,
 		return nil, fmt.Errorf("unmarshal note data: %w", err)
 	}
 
+	references, err := r.getLatestReferences(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+	frontMatter, err := r.getLatestFrontMatter(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &NoteResponse{
-		Revision:   note.LatestRevision,
-		Channel:    note.Channel,
-		Permission: note.Permission,
-		Body:       note.Body,
+		Revision:    note.LatestRevision,
+		References:  references,
+		FrontMatter: frontMatter,
+		Channel:     note.Channel,
+		ChannelPath: r.channelPathResolver(ctx)(note.Channel),
+		Permission:  note.Permission,
+		Body:        note.Body,
 	}, nil
 }
 
@@ -155,7 +225,7 @@ func (r *Repository) DeleteNote(ctx context.Context, noteID string) error {
 	}
 	// SQLのdeleted_atを更新
 	query := `UPDATE notes SET deleted_at = ? WHERE id = ?`
-	_, err = r.db.Exec(query, time.Now(), noteID)
+	_, err = r.db.Exec(query, time.Now().Unix(), noteID)
 	if err != nil {
 		if err.Error() == "note not found" {
 
@@ -163,7 +233,11 @@ func (r *Repository) DeleteNote(ctx context.Context, noteID string) error {
 		}
 		log.Printf("DB Error: %s", err)
 
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error").SetInternal(fmt.Errorf("update note deleted_at: %w", err))
+	}
+
+	if err := r.breakNoteLinks(ctx, noteID); err != nil {
+		return err
 	}
 
 	return nil
@@ -206,111 +280,204 @@ func (r *Repository) CreateUser(ctx context.Context, params CreateUserParams) (u
 	return userID, nil
 }
 
-func (r *Repository) CreateNote(ctx context.Context, channelID uuid.UUID) (uuid.UUID, uuid.UUID, string, uuid.UUID, error) {
+// CreateNote ノートと最初のリビジョンを作成する．本文が空の場合は「新規ノート」というタイトルにする
+// MySQLへの書き込みは1つのトランザクションで行い，ESへの登録に失敗した場合はロールバックする
+func (r *Repository) CreateNote(ctx context.Context, params CreateNoteParams) (*NoteResponse, error) {
 	noteID, _ := uuid.NewV7()
 	revisionID, _ := uuid.NewV7()
-	permission := "limited"
-	doc := map[string]interface{}{
-		"id":             noteID.String(),
-		"latestRevision": revisionID.String(),
-		"channel":        channelID.String(),
-		"permission":     permission,
-		"title":          "新規ノート",
-		"summary":        "新しく作成されたノート",
-		"body":           "",
-		"tag":            []string{},
-		"createdAt":      time.Now().Unix(),
-		"updatedAt":      time.Now().Unix(),
-	}
-	log.Printf("doc: %v", doc)
-	resp, err := r.es.Index("notes").Document(doc).Id(noteID.String()).Do(ctx) // Elasticsearchにインデックス登録
+	if params.Permission == "" {
+		params.Permission = "limited"
+	}
+	ancestry, err := r.getChannelAncestry(ctx, params.Channel)
 	if err != nil {
-		return noteID, channelID, permission, revisionID, fmt.Errorf("index user in ES: %w", err)
+		return nil, err
 	}
-	_ = resp
 
-	query := `INSERT INTO notes (ID, latest_revision, created_at, deleted_at, updated_at) VALUES (?, ?, ?, ?, ?)`
-	_, err = r.db.Exec(query, noteID, revisionID, time.Now().Unix(), nil, time.Now().Unix())
+	tx, err := r.db.Beginx()
 	if err != nil {
-		log.Printf("DB Error: %s", err)
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-		return noteID, channelID, permission, revisionID, echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	if params.Template != nil {
+		params.Title, params.Body, err = r.renderTemplate(tx, *params.Template, params.UserName, ancestry)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	query = `INSERT INTO note_revisions (note_id, revision_id, channel, permission, title, summary, body, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err = r.db.Exec(query, noteID, revisionID, channelID, permission, "新規ノート", "新しく作成されたノート", "", time.Now().Unix())
+	body := params.Body
+	references := notebody.ExtractReferences(body, r.channelIDResolver(ctx))
+	metadata := noterender.ExtractMetadata(body)
+	if params.Title != "" {
+		metadata.Title = params.Title
+	}
+	if body == "" {
+		metadata.Summary = "新しく作成されたノート"
+	}
+	if metadata.Title == "" {
+		metadata.Title = "新規ノート"
+	}
+	for _, tag := range params.Tags {
+		if !slices.Contains(metadata.Tags, tag) {
+			metadata.Tags = append(metadata.Tags, tag)
+		}
+	}
+	if metadata.Tags == nil {
+		metadata.Tags = []string{}
+	}
+	frontMatter, _, err := notebody.SplitFrontMatter(body)
 	if err != nil {
-		log.Printf("DB Error: %s", err)
-
-		return noteID, channelID, permission, revisionID, echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		frontMatter = nil
 	}
+	frontMatterJSON, err := marshalFrontMatter(frontMatter)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
 
-	return noteID, channelID, permission, revisionID, nil
-}
+	query := `INSERT INTO notes (id, latest_revision, created_at, deleted_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(query, noteID, revisionID, now, nil, now); err != nil {
+		return nil, fmt.Errorf("insert note: %w", err)
+	}
+	query = `INSERT INTO note_revisions (note_id, revision_id, channel, permission, title, summary, body, front_matter, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(query, noteID, revisionID, params.Channel, params.Permission, metadata.Title, metadata.Summary, body, frontMatterJSON, now); err != nil {
+		return nil, fmt.Errorf("insert note revision: %w", err)
+	}
+	if err := r.insertReferences(ctx, tx, noteID, revisionID, references); err != nil {
+		return nil, err
+	}
+	if err := r.replaceNoteLinks(ctx, tx, noteID, revisionID, body); err != nil {
+		return nil, err
+	}
 
-func (r *Repository) UpdateNote(ctx context.Context, noteID uuid.UUID, params UpdateNoteParams) error {
-	// titleはbodyの1行目を取得する
-	title := "新規ノート"
-	if params.Body != "" {
-		lines := strings.Split(params.Body, "\n")
-		if len(lines) > 0 {
-			title = strings.TrimSpace(lines[0])
+	doc := map[string]interface{}{
+		"id":               noteID.String(),
+		"latestRevision":   revisionID.String(),
+		"channel":          params.Channel.String(),
+		"channelAncestors": ancestry.Ancestors,
+		"channelPath":      ancestry.Path,
+		"permission":       params.Permission,
+		"title":            metadata.Title,
+		"summary":          metadata.Summary,
+		"body":             body,
+		"plainText":        noterender.PlainText(body),
+		"tag":              metadata.Tags,
+		"tagPaths":         tagPaths(metadata.Tags),
+		"mentions":         notebody.MentionedUsers(references),
+		"frontMatter":      frontMatterDocument(frontMatter),
+		"createdAt":        now,
+		"updatedAt":        now,
+	}
+	if _, err := r.es.Index("notes").Document(doc).Id(noteID.String()).Do(ctx); err != nil {
+		return nil, fmt.Errorf("index note in ES: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		if _, err := r.es.Delete("notes", noteID.String()).Do(ctx); err != nil {
+			log.Printf("failed to delete note %s from ES: %v", noteID, err)
 		}
+
+		return nil, fmt.Errorf("commit transaction: %w", err)
 	}
 
-	// summaryはbodyの最初の100文字を取得する
-	summary := ""
-	if params.Body != "" {
-		runes := []rune(params.Body)
-		if len(runes) > 100 {
-			summary = string(runes[:100]) + "..." // 100文字を超える場合は省略記号を付ける
-		} else {
-			summary = params.Body // 100文字未満ならそのまま
-		}
+	if err := r.resolveTitleLinks(ctx, noteID, metadata.Title); err != nil {
+		log.Printf("failed to resolve links to note %s: %v", noteID, err)
 	}
+	r.notifyNoteChange(ctx, noteID, revisionID, &Note{}, &Note{
+		Channel:    params.Channel.String(),
+		Permission: params.Permission,
+		Title:      metadata.Title,
+		Summary:    metadata.Summary,
+		Body:       body,
+	}, params.UserName)
 
-	// tagはbodyの中にある#で始まる単語を取得することとする
-	tags := []string{}
-	if params.Body != "" {
-		words := strings.Fields(params.Body)
-		for _, word := range words {
-			if strings.HasPrefix(word, "#") {
-				tag := strings.TrimPrefix(word, "#")
-				tag = strings.TrimSpace(tag)
-				if tag != "" {
-					tags = append(tags, tag)
-				}
-			}
-		}
+	// GET /notes/:noteIdと同じく，保存した形のfront matterを返す
+	normalized, _ := normalizeFrontMatter(frontMatter).(map[string]any)
+
+	return &NoteResponse{
+		Revision:       revisionID.String(),
+		References:     references,
+		FrontMatter:    normalized,
+		Channel:        params.Channel.String(),
+		ChannelPath:    ancestry.Path,
+		Permission:     params.Permission,
+		Title:          metadata.Title,
+		Tags:           metadata.Tags,
+		Body:           body,
+		ID:             noteID,
+		LatestRevision: revisionID,
+		CreatedAt:      int32(now),
+		UpdatedAt:      int32(now),
+	}, nil
+}
+
+func (r *Repository) UpdateNote(ctx context.Context, noteID uuid.UUID, params UpdateNoteParams) error {
+	// メンションやチャンネルへの参照を取り出す．本文は埋め込み記法のまま保存する
+	references := notebody.ExtractReferences(params.Body, r.channelIDResolver(ctx))
+
+	// クライアントが明示したタイトル・要約・タグは本文から導出したものより優先する
+	metadata := noterender.ExtractMetadata(params.Body)
+	if params.Title != "" {
+		metadata.Title = params.Title
+	}
+	if params.Summary != "" {
+		metadata.Summary = params.Summary
+	}
+	if params.Tags != nil {
+		metadata.Tags = params.Tags
+	}
+	// 不正なfront matterは本文の一部として扱う
+	frontMatter, _, err := notebody.SplitFrontMatter(params.Body)
+	if err != nil {
+		frontMatter = nil
+	}
+	frontMatterJSON, err := marshalFrontMatter(frontMatter)
+	if err != nil {
+		return err
 	}
 
-	doc := map[string]interface{}{
-		"channel":    params.Channel.String(),
-		"permission": params.Permission,
-		"revision":   params.Revision.String(),
-		"body":       params.Body,
-		"title":      title,
-		"summary":    summary,
-		"tag":        tags,
-		"updatedAt":  time.Now().Unix(),
+	ancestry, err := r.getChannelAncestry(ctx, params.Channel)
+	if err != nil {
+		return err
 	}
 
-	_, err := r.es.Update("notes", noteID.String()).Doc(doc).Do(ctx)
+	prev, err := r.getNoteDocument(ctx, noteID.String())
 	if err != nil {
+		return err
+	}
 
-		return fmt.Errorf("update note in ES: %w", err)
+	doc := map[string]interface{}{
+		"channel":          params.Channel.String(),
+		"channelAncestors": ancestry.Ancestors,
+		"channelPath":      ancestry.Path,
+		"permission":       params.Permission,
+		"revision":         params.Revision.String(),
+		"body":             params.Body,
+		"plainText":        noterender.PlainText(params.Body),
+		"title":            metadata.Title,
+		"summary":          metadata.Summary,
+		"tag":              metadata.Tags,
+		"tagPaths":         tagPaths(metadata.Tags),
+		"mentions":         notebody.MentionedUsers(references),
+		"frontMatter":      frontMatterDocument(frontMatter),
+		"updatedAt":        time.Now().Unix(),
+	}
+
+	if err := r.replaceNoteFields(ctx, noteID, doc); err != nil {
+		return err
 	}
 
 	// SQLからdeleted_atのみ取ってくる
 	query := `SELECT deleted_at FROM notes WHERE id = ?`
 
-	var deletedAt sql.NullTime
+	var deletedAt sql.NullInt64
 	err = r.db.QueryRow(query, noteID).Scan(&deletedAt)
 
 	if err != nil {
 		log.Printf("DB Error (deleted_at select): %v", err)
 
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error").SetInternal(fmt.Errorf("select note deleted_at: %w", err))
 	}
 	if deletedAt.Valid {
 
@@ -324,22 +491,70 @@ func (r *Repository) UpdateNote(ctx context.Context, noteID uuid.UUID, params Up
 	if err != nil {
 		log.Printf("DB Error: %s", err)
 
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error").SetInternal(fmt.Errorf("update note latest revision: %w", err))
 	}
 
-	query = `INSERT INTO note_revisions (note_id, revision_id, channel, permission, title, summary, body, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err = r.db.Exec(query, noteID, revisionID.String(), params.Channel, params.Permission, params.Title, params.Summary, params.Body, time.Now().Unix())
+	query = `INSERT INTO note_revisions (note_id, revision_id, channel, permission, title, summary, body, front_matter, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = r.db.Exec(query, noteID, revisionID.String(), params.Channel, params.Permission, metadata.Title, metadata.Summary, params.Body, frontMatterJSON, time.Now().Unix())
 
 	if err != nil {
 		log.Printf("DB Error: %s", err)
 
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error").SetInternal(fmt.Errorf("insert note revision: %w", err))
 	}
 
+	if err := r.insertReferences(ctx, r.db, noteID, revisionID, references); err != nil {
+		return err
+	}
+	if err := r.updateNoteLinks(ctx, noteID, revisionID, params.Body); err != nil {
+		return err
+	}
+	if err := r.resolveTitleLinks(ctx, noteID, metadata.Title); err != nil {
+		return err
+	}
+	if prev.Body != params.Body {
+		r.reanchorComments(ctx, noteID, revisionID, prev.Body, params.Body)
+	}
+	if prev.Title != metadata.Title {
+		r.retitleNoteLinks(ctx, noteID, prev.Title, metadata.Title)
+	}
+
+	if params.Notify != nil {
+		if err := r.SetNoteNotificationEnabled(ctx, noteID, *params.Notify); err != nil {
+			return err
+		}
+	}
+	r.notifyNoteChange(ctx, noteID, revisionID, prev, &Note{
+		Channel:    params.Channel.String(),
+		Permission: params.Permission,
+		Title:      metadata.Title,
+		Summary:    metadata.Summary,
+		Body:       params.Body,
+	}, params.UserName)
+
 	return nil
 }
 
-func (r *Repository) GetNoteHistory(_ context.Context, noteID string, limit int, offset int) ([]GetNoteHistoryResponse, error) {
+// replaceNoteFields ESのノートのドキュメントのフィールドを置き換える
+// 部分更新ではオブジェクトのフィールドがマージされ，front matterから消えたキーが残るため，スクリプトでフィールドごと置き換える
+func (r *Repository) replaceNoteFields(ctx context.Context, noteID uuid.UUID, fields map[string]any) error {
+	params, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("marshal note fields: %w", err)
+	}
+
+	_, err = r.es.Update("notes", noteID.String()).Script(&types.Script{
+		Source: "for (entry in params.fields.entrySet()) { ctx._source[entry.getKey()] = entry.getValue() }",
+		Params: map[string]json.RawMessage{"fields": params},
+	}).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("update note in ES: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) GetNoteHistory(ctx context.Context, noteID string, limit int, offset int) ([]GetNoteHistoryResponse, error) {
 	query := `SELECT revision_id, channel, permission, updated_at, body FROM note_revisions WHERE note_id = ? ORDER BY updated_at DESC LIMIT ? OFFSET ?`
 	histories := []GetNoteHistoryResponse{}
 	err := r.db.Select(&histories, query, noteID, limit, offset)
@@ -353,6 +568,11 @@ func (r *Repository) GetNoteHistory(_ context.Context, noteID string, limit int,
 		return nil, echo.NewHTTPError(http.StatusNotFound, "not found")
 	}
 
+	channelPath := r.channelPathResolver(ctx)
+	for i := range histories {
+		histories[i].ChannelPath = channelPath(histories[i].Channel.String())
+	}
+
 	return histories, nil
 }
 
@@ -374,14 +594,54 @@ func NewMatchQuery(field string, queryText string) types.Query {
 	}
 }
 
-func NewRegexQuery(field string, pattern string) types.Query {
-	return types.Query{
-		Regexp: map[string]types.RegexpQuery{
-			field: {Value: pattern},
-		},
+// GetNotesParams.Opの値
+const (
+	SearchOpAnd = "and"
+	SearchOpOr  = "or"
+)
+
+// maxRegexStates 正規表現の検索でESが作るオートマトンの状態数の上限
+const maxRegexStates = 10000
+
+// ErrInvalidSearch ESが検索条件を受け付けなかった．正規表現が複雑すぎる場合など
+var ErrInvalidSearch = errors.New("invalid search")
+
+// searchError ESが400を返した場合はErrInvalidSearchに理由を付けて返す
+func searchError(err error) error {
+	var esErr *types.ElasticsearchError
+	if !errors.As(err, &esErr) || esErr.Status != http.StatusBadRequest {
+		return err
+	}
+	reason := ""
+	if len(esErr.ErrorCause.RootCause) > 0 && esErr.ErrorCause.RootCause[0].Reason != nil {
+		reason = *esErr.ErrorCause.RootCause[0].Reason
+	} else if esErr.ErrorCause.Reason != nil {
+		reason = *esErr.ErrorCause.Reason
 	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidSearch, reason)
 }
 
+// patternQuery 検索モードに応じて，keywordのフィールドがpatternに一致するノートを探すクエリ
+// パターンはsearchpattern.Validateで検証しておく
+func patternQuery(field string, mode string, pattern string) types.Query {
+	switch mode {
+	case searchpattern.ModePrefix:
+		return types.Query{Prefix: map[string]types.PrefixQuery{field: {Value: pattern}}}
+	case searchpattern.ModeRegex:
+		return types.Query{
+			Regexp: map[string]types.RegexpQuery{
+				field: {
+					Value:                 pattern,
+					Flags:                 some.String("NONE"),
+					MaxDeterminizedStates: some.Int(maxRegexStates),
+				},
+			},
+		}
+	}
+
+	return NewTermQuery(field, pattern)
+}
 
 type mySortCombinations struct {
 	sortCombinations types.SortCombinations
@@ -391,120 +651,181 @@ func (s *mySortCombinations) SortCombinationsCaster() *types.SortCombinations {
 	return &s.sortCombinations
 }
 
-func (r *Repository) GetNotes(ctx context.Context, params GetNotesParams) ([]GetNotesResponse,int64, error) {
-	var mustQueries []types.Query
+// buildNotesQuery GetNotesParamsの検索条件をESのクエリに変換する
+func buildNotesQuery(params GetNotesParams) *types.Query {
 	var filterQueries []types.Query
-	var shouldQueries []types.Query
+	var mustNotQueries []types.Query
+	// チャンネルなどの絞り込みはスコアに影響させない
 	if params.Channel != "" {
-		shouldQueries = append(shouldQueries, NewTermQuery("channel.keyword", params.Channel))
-	}
-	if params.IncludeChild {
-		client := traq.NewAPIClient(traq.NewConfiguration())
-		auth := context.WithValue(context.Background(), traq.ContextAccessToken, r.token)
-		fmt.Println(r.token)
-		channels, _, err := client.ChannelApi.GetChannels(auth).Execute()
-		for err != nil {
-			return nil, 0, fmt.Errorf("get channels from traQ: %w", err)
-		}
-		m := map[string][]string{}
-		for _, c := range channels.Public {
-			m[c.Id] = c.Children
-		}
-		queue := make([]string, 0)
-		queue = append(queue, params.Channel)
-		for count := 0; len(queue) > 0 && count < 50; count++{ //BFS
-			currentID := queue[0]
-			queue = queue[1:]
- 			// チャンネルの子チャンネルを取得
-			children := m[currentID]
-			for _, child := range children {
-				// 子チャンネルのIDをキューに追加
-				queue = append(queue, child)
-				// 子チャンネルのIDをshouldQueriesに追加
-				shouldQueries = append(shouldQueries, NewTermQuery("channel.keyword", child))
-			}
+		filterQueries = append(filterQueries, channelQuery(params.Channel, params.IncludeChild))
+	}
+	// 除くチャンネルはincludeChildによらず子孫チャンネルのノートも除く
+	for _, channel := range params.NotChannels {
+		mustNotQueries = append(mustNotQueries, channelQuery(channel, true))
+	}
+	if params.MentionedUser != "" {
+		filterQueries = append(filterQueries, NewTermQuery("mentions.keyword", params.MentionedUser))
+	}
+	if params.StarredBy != "" {
+		filterQueries = append(filterQueries, NewTermQuery(starredByField, params.StarredBy))
+	}
+	for _, key := range slices.Sorted(maps.Keys(params.FrontMatter)) {
+		for _, value := range params.FrontMatter[key] {
+			filterQueries = append(filterQueries, frontMatterQuery(key, value))
 		}
 	}
+	for _, tag := range params.NotTags {
+		mustNotQueries = append(mustNotQueries, tagFilterQuery(tag, params.Mode, params.TagSynonyms[tag]))
+	}
+
+	// タイトル・本文・タグの条件はopで組み合わせる．タイトルと本文はスコアに反映する
+	var textQueries []types.Query
+	var tagQueries []types.Query
 	if params.Title != "" {
-		shouldQueries = append(shouldQueries, NewRegexQuery("title.keyword", params.Title))
-		shouldQueries = append(shouldQueries, NewMatchQuery("title", params.Title))
+		textQueries = append(textQueries, anyOf(
+			patternQuery("title.keyword", params.Mode, params.Title),
+			NewMatchQuery("title", params.Title),
+		))
 	}
 	if params.Body != "" {
-		shouldQueries = append(shouldQueries, NewRegexQuery("body.keyword", params.Body))
-		shouldQueries = append(shouldQueries, NewMatchQuery("body", params.Body))
+		textQueries = append(textQueries, anyOf(
+			patternQuery("body.keyword", params.Mode, params.Body),
+			NewMatchQuery("body", params.Body),
+			NewMatchQuery("plainText", params.Body),
+			attachmentTextQuery(params.Body),
+		))
 	}
-	if len(params.Tags) > 0 {
-		for _, tag := range params.Tags {
-			filterQueries = append(filterQueries, NewRegexQuery("tag.keyword", tag))
-		}
+	for _, tag := range params.Tags {
+		tagQueries = append(tagQueries, tagFilterQuery(tag, params.Mode, params.TagSynonyms[tag]))
 	}
-	query := &types.Query{
+
+	query := &types.BoolQuery{}
+	if params.Op == SearchOpOr && len(textQueries)+len(tagQueries) > 0 {
+		query.Should = append(textQueries, tagQueries...)
+		query.MinimumShouldMatch = 1
+	} else {
+		query.Must = textQueries
+		filterQueries = append(filterQueries, tagQueries...)
+	}
+	query.Filter = filterQueries
+	query.MustNot = mustNotQueries
+
+	return &types.Query{Bool: query}
+}
+
+// channelQuery チャンネルのノートに一致するクエリ．includeChildの場合は子孫チャンネルのノートにも一致させる
+func channelQuery(channel string, includeChild bool) types.Query {
+	if includeChild {
+		// 子孫チャンネルのノートはchannelAncestorsに指定したチャンネルを含む
+		return NewTermQuery("channelAncestors.keyword", channel)
+	}
+
+	return NewTermQuery("channel.keyword", channel)
+}
+
+// anyOf いずれかのクエリに一致するクエリ．一致したクエリのスコアを合計する
+func anyOf(queries ...types.Query) types.Query {
+	return types.Query{
 		Bool: &types.BoolQuery{
-			Filter: filterQueries,
-			Must:   mustQueries,
-			Should: shouldQueries,
+			Should:             queries,
+			MinimumShouldMatch: 1,
 		},
 	}
-	sort := &mySortCombinations{}
-	if params.SortKey != "" {
-		switch params.SortKey {
-		case "dateAsc":
-			sort = &mySortCombinations{
-				sortCombinations: types.SortOptions{
-					SortOptions: map[string]types.FieldSort{
-						"updatedAt": {Order: &sortorder.Asc,},
-					},
-				},
-			}
-		case "dateDesc":
-			sort = &mySortCombinations{
-				sortCombinations: types.SortOptions{
-					SortOptions: map[string]types.FieldSort{
-						"updatedAt": {Order: &sortorder.Desc,},
-					},
-				},
-			}
-		case "titleAsc":
-			sort = &mySortCombinations{
-				sortCombinations: types.SortOptions{
-					SortOptions: map[string]types.FieldSort{
-						"title.keyword": {Order: &sortorder.Asc,},
-					},
-				},
-			}
-		case "titleDesc":
-			sort = &mySortCombinations{
-				sortCombinations: types.SortOptions{
-					SortOptions: map[string]types.FieldSort{
-						"title.keyword": {Order: &sortorder.Desc,},
-					},
-				},
-			}
-		default:
-			return nil, 0, fmt.Errorf("invalid sortKey value: %s", params.SortKey)
+}
+
+// notesSort sortKeyをESのソート条件に変換する
+func notesSort(sortKey string) ([]types.SortCombinationsVariant, error) {
+	field := func(name string, order sortorder.SortOrder) types.SortCombinationsVariant {
+		return &mySortCombinations{
+			sortCombinations: types.SortOptions{
+				SortOptions: map[string]types.FieldSort{name: {Order: &order}},
+			},
 		}
 	}
+	switch sortKey {
+	case "":
+		return nil, nil
+	case "dateAsc":
+		return []types.SortCombinationsVariant{field("updatedAt", sortorder.Asc)}, nil
+	case "dateDesc":
+		return []types.SortCombinationsVariant{field("updatedAt", sortorder.Desc)}, nil
+	case "titleAsc":
+		return []types.SortCombinationsVariant{field("title.keyword", sortorder.Asc)}, nil
+	case "titleDesc":
+		return []types.SortCombinationsVariant{field("title.keyword", sortorder.Desc)}, nil
+	case "popular":
+		// スターの数が同じノートは新しく更新された順にする
+		return []types.SortCombinationsVariant{field(starCountField, sortorder.Desc), field("updatedAt", sortorder.Desc)}, nil
+	}
+
+	return nil, fmt.Errorf("invalid sortKey value: %s", sortKey)
+}
+
+func (r *Repository) GetNotes(ctx context.Context, params GetNotesParams) ([]GetNotesResponse, int64, error) {
+	params, err := r.withTagSynonyms(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	query := buildNotesQuery(params)
+	sort, err := notesSort(params.SortKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	if params.Channel != "" {
+		// チャンネルにピン留めされたノートを先頭にする
+		sort = append([]types.SortCombinationsVariant{pinnedFirstSort(params.Channel)}, sort...)
+	}
 
 	countRes, err := r.es.Count().Index("notes").Query(query).Do(ctx)
 	if err != nil {
-		return nil, 0, fmt.Errorf("count notes in ES: %w", err)
+		return nil, 0, searchError(fmt.Errorf("count notes in ES: %w", err))
 	}
 	total := countRes.Count
-	
-	res, err := r.es.Search().Index("notes").Query(query).Sort(sort).Size(params.Limit).From(params.Offset).Do(ctx)
+
+	// 添付ファイルのテキストは大きくなりうるため，検索結果には含めない
+	res, err := r.es.Search().Index("notes").Query(query).Sort(sort...).SourceExcludes_(attachmentsField).Size(params.Limit).From(params.Offset).Do(ctx)
 
 	if err != nil {
-		return nil, 0, fmt.Errorf("search notes in ES: %w", err)
+		return nil, 0, searchError(fmt.Errorf("search notes in ES: %w", err))
 	}
 
 	var notes []GetNotesResponse
+	channelPath := r.channelPathResolver(ctx)
 	for _, hit := range res.Hits.Hits {
 		var note GetNotesResponse
 		if err := json.Unmarshal(hit.Source_, &note); err != nil {
 			return nil, 0, fmt.Errorf("unmarshal note data: %w", err)
 		}
+		note.ChannelPath = channelPath(note.Channel)
+		var marks noteMarksDocument
+		if err := json.Unmarshal(hit.Source_, &marks); err != nil {
+			return nil, 0, fmt.Errorf("unmarshal note data: %w", err)
+		}
+		pinChannel := params.Channel
+		if pinChannel == "" {
+			pinChannel = note.Channel
+		}
+		note.StarCount = len(marks.StarredBy)
+		note.Starred = params.UserName != "" && slices.Contains(marks.StarredBy, params.UserName)
+		note.Pinned = slices.Contains(marks.PinnedIn, pinChannel)
+		note.MatchedAttachments, err = matchedAttachments(hit)
+		if err != nil {
+			return nil, 0, err
+		}
 		notes = append(notes, note)
 	}
 
+	noteIDs := make([]string, 0, len(notes))
+	for _, note := range notes {
+		noteIDs = append(noteIDs, note.ID)
+	}
+	commentCounts, err := r.countComments(ctx, noteIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range notes {
+		notes[i].CommentCount = commentCounts[notes[i].ID]
+	}
+
 	return notes, total, nil
 }
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildNotesQuery(t *testing.T) {
+	const (
+		titleFoo = `{"bool":{"minimum_should_match":1,"should":[{"term":{"title.keyword":{"value":"foo"}}},{"match":{"title":{"query":"foo"}}}]}}`
+		bodyBar  = `{"bool":{"minimum_should_match":1,"should":[{"term":{"body.keyword":{"value":"bar"}}},{"match":{"body":{"query":"bar"}}},{"match":{"plainText":{"query":"bar"}}},{"nested":{"ignore_unmapped":true,"inner_hits":{"_source":{"includes":["attachments.id","attachments.fileName"]},"name":"attachments"},"path":"attachments","query":{"match":{"attachments.text":{"query":"bar"}}}}}]}}`
+	)
+	tests := []struct {
+		name   string
+		params GetNotesParams
+		want   string
+	}{
+		{
+			name:   "no conditions",
+			params: GetNotesParams{},
+			want:   `{"bool":{}}`,
+		},
+		{
+			name:   "channel is a filter and title is required",
+			params: GetNotesParams{Channel: "c1", Title: "foo"},
+			want:   `{"bool":{"filter":[{"term":{"channel.keyword":{"value":"c1"}}}],"must":[` + titleFoo + `]}}`,
+		},
+		{
+			name:   "child channels",
+			params: GetNotesParams{Channel: "c1", IncludeChild: true},
+			want:   `{"bool":{"filter":[{"term":{"channelAncestors.keyword":{"value":"c1"}}}]}}`,
+		},
+		{
+			name:   "and",
+			params: GetNotesParams{Title: "foo", Body: "bar", Tags: []string{"a"}, Op: SearchOpAnd},
+			want:   `{"bool":{"filter":[{"term":{"tag.keyword":{"value":"a"}}}],"must":[` + titleFoo + `,` + bodyBar + `]}}`,
+		},
+		{
+			name:   "or",
+			params: GetNotesParams{Channel: "c1", Title: "foo", Body: "bar", Tags: []string{"a"}, Op: SearchOpOr},
+			want:   `{"bool":{"filter":[{"term":{"channel.keyword":{"value":"c1"}}}],"minimum_should_match":1,"should":[` + titleFoo + `,` + bodyBar + `,{"term":{"tag.keyword":{"value":"a"}}}]}}`,
+		},
+		{
+			name:   "or without text criteria",
+			params: GetNotesParams{Channel: "c1", Op: SearchOpOr},
+			want:   `{"bool":{"filter":[{"term":{"channel.keyword":{"value":"c1"}}}]}}`,
+		},
+		{
+			name:   "exclusions exclude child channels without includeChild",
+			params: GetNotesParams{Channel: "c1", NotTags: []string{"a"}, NotChannels: []string{"c2", "c3"}},
+			want:   `{"bool":{"filter":[{"term":{"channel.keyword":{"value":"c1"}}}],"must_not":[{"term":{"channelAncestors.keyword":{"value":"c2"}}},{"term":{"channelAncestors.keyword":{"value":"c3"}}},{"term":{"tag.keyword":{"value":"a"}}}]}}`,
+		},
+		{
+			name:   "exclusions with includeChild and tag synonyms",
+			params: GetNotesParams{Channel: "c1", IncludeChild: true, NotChannels: []string{"c2"}, NotTags: []string{"a"}, TagSynonyms: map[string][]string{"a": {"b"}}},
+			want:   `{"bool":{"filter":[{"term":{"channelAncestors.keyword":{"value":"c1"}}}],"must_not":[{"term":{"channelAncestors.keyword":{"value":"c2"}}},{"bool":{"minimum_should_match":1,"should":[{"term":{"tag.keyword":{"value":"a"}}},{"term":{"tag.keyword":{"value":"b"}}}]}}]}}`,
+		},
+		{
+			name:   "other filters",
+			params: GetNotesParams{Title: "foo", MentionedUser: "toki", StarredBy: "ikura", FrontMatter: map[string][]string{"status": {""}}},
+			want:   `{"bool":{"filter":[{"term":{"mentions.keyword":{"value":"toki"}}},{"term":{"starredBy":{"value":"ikura"}}},{"exists":{"field":"frontMatter.status"}}],"must":[` + titleFoo + `]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(buildNotesQuery(tt.params))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("buildNotesQuery() = %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/traP-jp/circuledge-backend/internal/notifier"
+)
+
+// maxNotificationAttempts 告知の送信を諦めるまでの試行回数
+const maxNotificationAttempts = 5
+
+type noteNotification struct {
+	ID         string         `db:"id"`
+	NoteID     string         `db:"note_id"`
+	RevisionID string         `db:"revision_id"`
+	Channel    string         `db:"channel"`
+	MessageID  sql.NullString `db:"message_id"`
+	Published  bool           `db:"published"`
+	Attempts   int            `db:"attempts"`
+}
+
+// getNoteDocument ESに保存されているノートのドキュメントを取得する
+func (r *Repository) getNoteDocument(ctx context.Context, noteID string) (*Note, error) {
+	res, err := r.es.Get("notes", noteID).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get note in ES: %w", err)
+	}
+	if !res.Found {
+		return nil, fmt.Errorf("note not found")
+	}
+
+	var note Note
+	if err := json.Unmarshal(res.Source_, &note); err != nil {
+		return nil, fmt.Errorf("unmarshal note data: %w", err)
+	}
+
+	return &note, nil
+}
+
+// SetNoteNotificationEnabled ノートごとにtraQへの告知を行うかどうかを設定する
+func (r *Repository) SetNoteNotificationEnabled(_ context.Context, noteID uuid.UUID, enabled bool) error {
+	query := `INSERT INTO note_notification_settings (note_id, enabled) VALUES (?, ?) ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)`
+	if _, err := r.db.Exec(query, noteID, enabled); err != nil {
+		return fmt.Errorf("upsert note notification setting: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserNotificationEnabled ユーザーが編集したノートをtraQに告知するかどうかを取得する
+func (r *Repository) GetUserNotificationEnabled(_ context.Context, userName string) (bool, error) {
+	var enabled bool
+	err := r.db.QueryRow(`SELECT enabled FROM user_notification_settings WHERE user_name = ?`, userName).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("select user notification setting: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// SetUserNotificationEnabled ユーザーが編集したノートをtraQに告知するかどうかを設定する
+func (r *Repository) SetUserNotificationEnabled(_ context.Context, userName string, enabled bool) error {
+	query := `INSERT INTO user_notification_settings (user_name, enabled) VALUES (?, ?) ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)`
+	if _, err := r.db.Exec(query, userName, enabled); err != nil {
+		return fmt.Errorf("upsert user notification setting: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repository) noteNotificationEnabled(ctx context.Context, noteID uuid.UUID, userName string) (bool, error) {
+	var enabled bool
+	err := r.db.QueryRow(`SELECT enabled FROM note_notification_settings WHERE note_id = ?`, noteID).Scan(&enabled)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("select note notification setting: %w", err)
+	}
+	if err == nil && !enabled {
+		return false, nil
+	}
+	if userName == "" {
+		return true, nil
+	}
+
+	return r.GetUserNotificationEnabled(ctx, userName)
+}
+
+// notifyNoteChange ノートが公開された場合や公開中のノートが大きく編集された場合にtraQへの告知を配信ログに追加する
+// 告知はWatchNotificationsが送信するため，ノートの更新は告知の成否を待たない
+func (r *Repository) notifyNoteChange(ctx context.Context, noteID uuid.UUID, revisionID uuid.UUID, prev *Note, next *Note, userName string) {
+	if r.notifier == nil || next.Permission != "public" || next.Channel == uuid.Nil.String() {
+		return
+	}
+	published := prev.Permission != "public"
+	if !published && prev.Channel == next.Channel && !notifier.IsSignificantEdit(prev.Title, prev.Body, next.Title, next.Body) {
+		return
+	}
+
+	enabled, err := r.noteNotificationEnabled(ctx, noteID, userName)
+	if err != nil {
+		log.Printf("notify note %s: %s", noteID, err)
+
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	id, _ := uuid.NewV7()
+	now := time.Now().Unix()
+	query := `INSERT INTO note_notifications (id, note_id, revision_id, channel, published, status, attempts, created_at, updated_at) VALUES (?, ?, ?, ?, ?, 'pending', 0, ?, ?)`
+	if _, err := r.db.Exec(query, id, noteID, revisionID, next.Channel, published, now, now); err != nil {
+		log.Printf("notify note %s: insert notification: %s", noteID, err)
+
+		return
+	}
+	signal(r.notificationQueued)
+}
+
+// deliverNotification 告知を送信し，結果を配信ログに記録する
+// 同じチャンネルに告知済みのメッセージがあれば編集する
+func (r *Repository) deliverNotification(ctx context.Context, n noteNotification, note *Note) error {
+	if !n.MessageID.Valid {
+		query := `SELECT message_id FROM note_notifications WHERE note_id = ? AND channel = ? AND status = 'sent' ORDER BY created_at DESC LIMIT 1`
+		err := r.db.QueryRow(query, n.NoteID, n.Channel).Scan(&n.MessageID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("select sent notification: %w", err)
+		}
+	}
+
+	messageID, err := r.notifier.Notify(ctx, notifier.Notification{
+		NoteID:    n.NoteID,
+		ChannelID: n.Channel,
+		Title:     note.Title,
+		Summary:   note.Summary,
+		MessageID: n.MessageID.String,
+		Published: n.Published,
+	})
+
+	now := time.Now().Unix()
+	if err != nil {
+		log.Printf("notify note %s: %s", n.NoteID, err)
+		query := `UPDATE note_notifications SET status = 'failed', message_id = ?, attempts = attempts + 1, last_error = ?, updated_at = ? WHERE id = ?`
+		if _, err := r.db.Exec(query, n.MessageID, err.Error(), now, n.ID); err != nil {
+			return fmt.Errorf("mark notification failed: %w", err)
+		}
+
+		return nil
+	}
+
+	query := `UPDATE note_notifications SET status = 'sent', message_id = ?, attempts = attempts + 1, last_error = NULL, updated_at = ? WHERE id = ?`
+	if _, err := r.db.Exec(query, messageID, now, n.ID); err != nil {
+		return fmt.Errorf("mark notification sent: %w", err)
+	}
+
+	return nil
+}
+
+// DeliverNotifications 配信ログにある未送信の告知と送信に失敗した告知を古い順に送信する
+// 送信時にはノートの最新の内容を告知し，非公開になったノートやチャンネルが変わったノートの告知は取り消す
+func (r *Repository) DeliverNotifications(ctx context.Context) error {
+	if r.notifier == nil {
+		return nil
+	}
+
+	queued := []noteNotification{}
+	query := `SELECT id, note_id, revision_id, channel, message_id, published, attempts FROM note_notifications WHERE status = 'pending' OR (status = 'failed' AND attempts < ?) ORDER BY created_at`
+	if err := r.db.Select(&queued, query, maxNotificationAttempts); err != nil {
+		return fmt.Errorf("select queued notifications: %w", err)
+	}
+
+	for _, n := range queued {
+		note, err := r.getNoteDocument(ctx, n.NoteID)
+		if err != nil || note.Permission != "public" || note.Channel != n.Channel {
+			query := `UPDATE note_notifications SET status = 'cancelled', updated_at = ? WHERE id = ?`
+			if _, err := r.db.Exec(query, time.Now().Unix(), n.ID); err != nil {
+				return fmt.Errorf("cancel notification: %w", err)
+			}
+
+			continue
+		}
+		if err := r.deliverNotification(ctx, n, note); err != nil {
+			return fmt.Errorf("deliver notification %s: %w", n.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// WatchNotifications 告知が配信ログに追加されたときと一定間隔ごとにDeliverNotificationsを実行する
+func (r *Repository) WatchNotifications(ctx context.Context, interval time.Duration) {
+	runPeriodically(ctx, interval, r.notificationQueued, func() {
+		if err := r.DeliverNotifications(ctx); err != nil {
+			log.Printf("deliver notifications: %s", err)
+		}
+	})
+}
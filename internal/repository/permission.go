@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+// CanReadNote ノートの権限に応じて，ユーザーがノートを読めるかどうかを判定する
+// userNameはログインしていない場合は空にする
+//
+//   - public: 誰でも読める
+//   - limited: ログイン中のユーザーが読める
+//   - private: ログイン中のユーザーがノートを直接開いた場合だけ読める．一覧や書き出しには含めない
+func CanReadNote(permission string, userName string) bool {
+	if permission == "public" {
+		return true
+	}
+
+	return userName != ""
+}
+
+// checkNoteReadable 削除されていないノートをユーザーが読めるか確かめる
+// 読めない場合はノートの取得と同じくErrNoteNotFoundを返す
+func (r *Repository) checkNoteReadable(ctx context.Context, noteID string, userName string) error {
+	permission, err := r.getNotePermission(ctx, noteID)
+	if err != nil {
+		return err
+	}
+	if !CanReadNote(permission, userName) {
+		return ErrNoteNotFound
+	}
+
+	return nil
+}
+
+// listedPermissions 一覧や書き出しにノートを含める権限
+func listedPermissions(userName string) []string {
+	if userName == "" {
+		return []string{"public"}
+	}
+
+	return []string{"public", "limited"}
+}
+
+// listedNotesQuery ユーザーが読めるノートのうち，一覧や書き出しに含めるノートに絞り込むクエリ
+func listedNotesQuery(userName string) types.Query {
+	permissions := listedPermissions(userName)
+	values := make([]types.FieldValue, 0, len(permissions))
+	for _, permission := range permissions {
+		values = append(values, permission)
+	}
+
+	return types.Query{
+		Terms: &types.TermsQuery{
+			TermsQuery: map[string]types.TermsQueryField{"permission.keyword": values},
+		},
+	}
+}
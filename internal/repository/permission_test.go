@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCanReadNote(t *testing.T) {
+	tests := []struct {
+		permission string
+		userName   string
+		want       bool
+	}{
+		{permission: "public", userName: "", want: true},
+		{permission: "public", userName: "toki", want: true},
+		{permission: "limited", userName: "", want: false},
+		{permission: "limited", userName: "toki", want: true},
+		{permission: "private", userName: "", want: false},
+		{permission: "private", userName: "toki", want: true},
+	}
+	for _, tt := range tests {
+		if got := CanReadNote(tt.permission, tt.userName); got != tt.want {
+			t.Errorf("CanReadNote(%q, %q) = %v, want %v", tt.permission, tt.userName, got, tt.want)
+		}
+	}
+}
+
+func TestListedNotesQuery(t *testing.T) {
+	tests := []struct {
+		userName string
+		want     string
+	}{
+		{userName: "", want: `{"terms":{"permission.keyword":["public"]}}`},
+		{userName: "toki", want: `{"terms":{"permission.keyword":["public","limited"]}}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(listedNotesQuery(tt.userName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("listedNotesQuery(%q) = %s, want %s", tt.userName, b, tt.want)
+		}
+	}
+}
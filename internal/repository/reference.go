@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+)
+
+// maxReferenceRawLength note_revision_references.rawに保存する表記の最大文字数
+const maxReferenceRawLength = 255
+
+func (r *Repository) insertReferences(_ context.Context, db sqlx.Execer, noteID uuid.UUID, revisionID uuid.UUID, references []notebody.Reference) error {
+	query := `INSERT IGNORE INTO note_revision_references (revision_id, note_id, type, target_id, raw) VALUES (?, ?, ?, ?, ?)`
+	for _, ref := range references {
+		targetID := sql.NullString{String: ref.ID, Valid: ref.ID != ""}
+		if _, err := db.Exec(query, revisionID, noteID, ref.Type, targetID, truncateRunes(ref.Raw, maxReferenceRawLength)); err != nil {
+			return fmt.Errorf("insert note revision reference: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// getLatestReferences ノートの最新リビジョンの本文中の参照を取得する
+func (r *Repository) getLatestReferences(_ context.Context, noteID string) ([]notebody.Reference, error) {
+	rows := []struct {
+		Type     string         `db:"type"`
+		TargetID sql.NullString `db:"target_id"`
+		Raw      string         `db:"raw"`
+	}{}
+	query := `SELECT ref.type, ref.target_id, ref.raw FROM note_revision_references ref JOIN notes n ON n.latest_revision = ref.revision_id WHERE n.id = ?`
+	if err := r.db.Select(&rows, query, noteID); err != nil {
+		return nil, fmt.Errorf("select note revision references: %w", err)
+	}
+
+	references := make([]notebody.Reference, 0, len(rows))
+	for _, row := range rows {
+		references = append(references, notebody.Reference{
+			Type: row.Type,
+			ID:   row.TargetID.String,
+			Raw:  row.Raw,
+		})
+	}
+
+	return references, nil
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+
+	return s
+}
@@ -1,16 +1,73 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/elastic/go-elasticsearch/v9"
 	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/blobstore"
+	"github.com/traP-jp/circuledge-backend/internal/notifier"
+	"github.com/traP-jp/circuledge-backend/internal/textextract"
+	traq "github.com/traPtitech/go-traq"
 )
 
 type Repository struct {
-	db    *sqlx.DB
-	es    *elasticsearch.TypedClient
-	token string
+	db       *sqlx.DB
+	es       *elasticsearch.TypedClient
+	token    string
+	notifier *notifier.Notifier
+	blobs    blobstore.BlobStore
+	// extractor 添付ファイルから検索用のテキストを取り出す．nilの場合は取り出さない
+	extractor *textextract.Extractor
+
+	ancestryCache channelAncestryCache
+	// notificationQueued 告知を配信ログに追加したことを配信ワーカーに知らせる
+	notificationQueued chan struct{}
+	// attachmentQueued 添付ファイルが追加されたことをテキストを取り出すワーカーに知らせる
+	attachmentQueued chan struct{}
+}
+
+func New(db *sqlx.DB, es *elasticsearch.TypedClient, token string, n *notifier.Notifier, blobs blobstore.BlobStore, extractor *textextract.Extractor) *Repository {
+	return &Repository{
+		db:                 db,
+		es:                 es,
+		token:              token,
+		notifier:           n,
+		blobs:              blobs,
+		extractor:          extractor,
+		notificationQueued: make(chan struct{}, 1),
+		attachmentQueued:   make(chan struct{}, 1),
+	}
+}
+
+// traqClient BOTのアクセストークンでtraQ APIを呼び出すためのクライアントとコンテキストを返す
+func (r *Repository) traqClient(ctx context.Context) (*traq.APIClient, context.Context) {
+	return traq.NewAPIClient(traq.NewConfiguration()), context.WithValue(ctx, traq.ContextAccessToken, r.token)
+}
+
+// runPeriodically ctxがキャンセルされるまでintervalごとにfnを実行する
+// wakeに通知が来た場合はintervalを待たずに実行する．nilの場合は通知を待たない
+func runPeriodically(ctx context.Context, interval time.Duration, wake <-chan struct{}, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
 }
 
-func New(db *sqlx.DB, es *elasticsearch.TypedClient, token string) *Repository {
-	return &Repository{db: db, es: es, token: token}
+// signal chに通知を送る．通知が溜まっている場合は何もしない
+func signal(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
 }
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/scriptsorttype"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/sortorder"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// starredByField スターを付けたユーザーのtraQ IDを入れるフィールド
+	starredByField = "starredBy"
+	// starCountField スターの数を入れるフィールド．sortKey=popularで使う
+	starCountField = "starCount"
+	// pinnedInField ノートをピン留めしたチャンネルのUUIDを入れるフィールド
+	pinnedInField = "pinnedIn"
+)
+
+var ErrNoteNotInChannel = errors.New("note is not in the channel")
+
+type (
+	// PinnedNote チャンネルにピン留めされたノート
+	PinnedNote struct {
+		ID          string `json:"id" db:"id"`
+		Channel     string `json:"channel" db:"channel"`
+		ChannelPath string `json:"channelPath,omitempty" db:"-"`
+		Permission  string `json:"permission" db:"permission"`
+		Title       string `json:"title" db:"title"`
+		Summary     string `json:"summary" db:"summary"`
+		UpdatedAt   int32  `json:"updatedAt" db:"updated_at"`
+		PinnedBy    string `json:"pinnedBy" db:"pinned_by"`
+		PinnedAt    int32  `json:"pinnedAt" db:"pinned_at"`
+	}
+
+	// noteMarksDocument ESのノートのドキュメントのスターとピン留めの項目
+	noteMarksDocument struct {
+		StarredBy []string `json:"starredBy"`
+		PinnedIn  []string `json:"pinnedIn"`
+	}
+)
+
+func noteMarksMappings() map[string]types.Property {
+	return map[string]types.Property{
+		starredByField: types.NewKeywordProperty(),
+		starCountField: types.NewIntegerNumberProperty(),
+		pinnedInField:  types.NewKeywordProperty(),
+	}
+}
+
+// pinnedFirstSort channelにピン留めされたノートを先頭にするソート条件
+func pinnedFirstSort(channel string) types.SortCombinationsVariant {
+	params, _ := json.Marshal(channel)
+
+	return &mySortCombinations{
+		sortCombinations: types.SortOptions{
+			Script_: &types.ScriptSort{
+				Script: types.Script{
+					Source: "doc['" + pinnedInField + "'].contains(params.channel) ? 1 : 0",
+					Params: map[string]json.RawMessage{"channel": params},
+				},
+				Type:  &scriptsorttype.Number,
+				Order: &sortorder.Desc,
+			},
+		},
+	}
+}
+
+// StarNote ユーザーのスターをノートに付ける．既に付けている場合は何もしない
+func (r *Repository) StarNote(ctx context.Context, userName string, noteID string) error {
+	exists, err := r.noteExists(ctx, noteID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoteNotFound
+	}
+
+	query := `INSERT IGNORE INTO note_stars (user_name, note_id, created_at) VALUES (?, ?, ?)`
+	if _, err := r.db.Exec(query, userName, noteID, time.Now().Unix()); err != nil {
+		return fmt.Errorf("insert note star: %w", err)
+	}
+
+	return r.syncNoteStars(ctx, noteID)
+}
+
+// UnstarNote ユーザーのスターをノートから外す．付けていない場合は何もしない
+func (r *Repository) UnstarNote(ctx context.Context, userName string, noteID string) error {
+	exists, err := r.noteExists(ctx, noteID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoteNotFound
+	}
+
+	if _, err := r.db.Exec(`DELETE FROM note_stars WHERE user_name = ? AND note_id = ?`, userName, noteID); err != nil {
+		return fmt.Errorf("delete note star: %w", err)
+	}
+
+	return r.syncNoteStars(ctx, noteID)
+}
+
+// syncNoteStars ノートにスターを付けたユーザーとスターの数をESのドキュメントに反映する
+func (r *Repository) syncNoteStars(ctx context.Context, noteID string) error {
+	userNames := []string{}
+	if err := r.db.Select(&userNames, `SELECT user_name FROM note_stars WHERE note_id = ? ORDER BY user_name`, noteID); err != nil {
+		return fmt.Errorf("select note stars: %w", err)
+	}
+
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return fmt.Errorf("parse note ID: %w", err)
+	}
+
+	return r.replaceNoteFields(ctx, id, map[string]any{
+		starredByField: userNames,
+		starCountField: len(userNames),
+	})
+}
+
+// PinNote ノートをチャンネルにピン留めする．ノートはチャンネルかその子孫チャンネルにあるものに限る
+func (r *Repository) PinNote(ctx context.Context, channelID uuid.UUID, noteID string, userName string) error {
+	var noteChannel string
+	query := `SELECT rev.channel FROM notes n JOIN note_revisions rev ON rev.revision_id = n.latest_revision WHERE n.id = ? AND n.deleted_at IS NULL`
+	if err := r.db.Get(&noteChannel, query, noteID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoteNotFound
+		}
+
+		return fmt.Errorf("select note channel: %w", err)
+	}
+	noteChannelID, err := uuid.Parse(noteChannel)
+	if err != nil {
+		return fmt.Errorf("parse channel ID: %w", err)
+	}
+	ancestry, err := r.getChannelAncestry(ctx, noteChannelID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(ancestry.Ancestors, channelID.String()) {
+		return ErrNoteNotInChannel
+	}
+
+	query = `INSERT IGNORE INTO channel_pins (channel_id, note_id, pinned_by, created_at) VALUES (?, ?, ?, ?)`
+	if _, err := r.db.Exec(query, channelID, noteID, userName, time.Now().Unix()); err != nil {
+		return fmt.Errorf("insert channel pin: %w", err)
+	}
+
+	return r.syncNotePins(ctx, noteID)
+}
+
+// UnpinNote ノートのチャンネルへのピン留めを外す．ピン留めしていない場合は何もしない
+func (r *Repository) UnpinNote(ctx context.Context, channelID uuid.UUID, noteID string) error {
+	exists, err := r.noteExists(ctx, noteID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoteNotFound
+	}
+
+	if _, err := r.db.Exec(`DELETE FROM channel_pins WHERE channel_id = ? AND note_id = ?`, channelID, noteID); err != nil {
+		return fmt.Errorf("delete channel pin: %w", err)
+	}
+
+	return r.syncNotePins(ctx, noteID)
+}
+
+// syncNotePins ノートをピン留めしたチャンネルをESのドキュメントに反映する
+func (r *Repository) syncNotePins(ctx context.Context, noteID string) error {
+	channelIDs := []string{}
+	if err := r.db.Select(&channelIDs, `SELECT channel_id FROM channel_pins WHERE note_id = ? ORDER BY channel_id`, noteID); err != nil {
+		return fmt.Errorf("select channel pins: %w", err)
+	}
+
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return fmt.Errorf("parse note ID: %w", err)
+	}
+
+	return r.replaceNoteFields(ctx, id, map[string]any{pinnedInField: channelIDs})
+}
+
+// GetPinnedNotes チャンネルにピン留めされたノートをピン留めした順に取得する
+// 削除されたノートと，ユーザーの一覧に含めない権限のノートは含めない
+func (r *Repository) GetPinnedNotes(ctx context.Context, channelID uuid.UUID, userName string) ([]PinnedNote, error) {
+	notes := []PinnedNote{}
+	query, args, err := sqlx.In(`SELECT n.id, rev.channel, rev.permission, rev.title, rev.summary, n.updated_at, p.pinned_by, p.created_at AS pinned_at
+		FROM channel_pins p
+		JOIN notes n ON n.id = p.note_id
+		JOIN note_revisions rev ON rev.revision_id = n.latest_revision
+		WHERE p.channel_id = ? AND n.deleted_at IS NULL AND rev.permission IN (?)
+		ORDER BY p.created_at, n.id`, channelID, listedPermissions(userName))
+	if err != nil {
+		return nil, fmt.Errorf("build pinned notes query: %w", err)
+	}
+	if err := r.db.Select(&notes, query, args...); err != nil {
+		return nil, fmt.Errorf("select pinned notes: %w", err)
+	}
+
+	channelPath := r.channelPathResolver(ctx)
+	for i := range notes {
+		notes[i].ChannelPath = channelPath(notes[i].Channel)
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+)
+
+func TestNotesSort(t *testing.T) {
+	tests := []struct {
+		sortKey string
+		want    string
+	}{
+		{sortKey: "", want: `null`},
+		{sortKey: "dateDesc", want: `[{"updatedAt":{"order":"desc"}}]`},
+		{sortKey: "popular", want: `[{"starCount":{"order":"desc"}},{"updatedAt":{"order":"desc"}}]`},
+	}
+	for _, tt := range tests {
+		sort, err := notesSort(tt.sortKey)
+		if err != nil {
+			t.Fatalf("notesSort(%q) error: %v", tt.sortKey, err)
+		}
+		if got := marshalSort(t, sort); got != tt.want {
+			t.Errorf("notesSort(%q) = %s, want %s", tt.sortKey, got, tt.want)
+		}
+	}
+
+	if _, err := notesSort("stars"); err == nil {
+		t.Error("notesSort(\"stars\") error = nil, want error")
+	}
+}
+
+func TestPinnedFirstSort(t *testing.T) {
+	got := marshalSort(t, []types.SortCombinationsVariant{pinnedFirstSort("0197882d-208b-7c5a-bf60-89eafb904106")})
+	want := `[{"_script":{"order":"desc","script":{"params":{"channel":"0197882d-208b-7c5a-bf60-89eafb904106"},"source":"doc['pinnedIn'].contains(params.channel) ? 1 : 0"},"type":"number"}}]`
+	if got != want {
+		t.Errorf("pinnedFirstSort() = %s, want %s", got, want)
+	}
+}
+
+func marshalSort(t *testing.T, sort []types.SortCombinationsVariant) string {
+	t.Helper()
+	if sort == nil {
+		return "null"
+	}
+	combinations := make([]*types.SortCombinations, 0, len(sort))
+	for _, s := range sort {
+		combinations = append(combinations, s.SortCombinationsCaster())
+	}
+	b, err := json.Marshal(combinations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
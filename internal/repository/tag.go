@@ -0,0 +1,384 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/sortorder"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/notebody"
+	"github.com/traP-jp/circuledge-backend/internal/searchpattern"
+)
+
+// MaxTags GET /tagsで一度に取得できるタグの最大数
+const MaxTags = 1000
+
+// tagPageSize タグを付け替えるノートを一度にESから取得する数
+const tagPageSize = 500
+
+var (
+	ErrTagNotFound = errors.New("tag not found")
+	ErrTagExists   = errors.New("tag already exists")
+)
+
+// TagCount タグとそのタグが付いたノートの数
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+	// Synonyms 検索時に展開される同義語
+	Synonyms []string `json:"synonyms,omitempty"`
+}
+
+// tagQuery タグが完全に一致するノートを探すクエリ
+func tagQuery(tag string) types.Query {
+	return NewTermQuery("tag.keyword", tag)
+}
+
+// GetTags ノートに付いているタグを多い順に取得する
+func (r *Repository) GetTags(ctx context.Context, limit int) ([]TagCount, error) {
+	res, err := r.es.Search().Index("notes").Size(0).Aggregations(map[string]types.Aggregations{
+		"tags": {
+			Terms: &types.TermsAggregation{
+				Field: some.String("tag.keyword"),
+				Size:  some.Int(min(limit, MaxTags)),
+			},
+		},
+	}).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate notes by tag in ES: %w", err)
+	}
+
+	tags := termsBuckets(res.Aggregations["tags"])
+
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	synonyms, err := r.tagSynonyms(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tags {
+		tags[i].Synonyms = synonyms[tags[i].Name]
+	}
+
+	return tags, nil
+}
+
+// countTag タグが付いたノートの数を数える
+func (r *Repository) countTag(ctx context.Context, tag string) (int64, error) {
+	query := tagQuery(tag)
+	res, err := r.es.Count().Index("notes").Query(&query).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("count notes in ES: %w", err)
+	}
+
+	return res.Count, nil
+}
+
+// RenameTag タグの名前を変える．新しい名前のタグが既にある場合はErrTagExistsを返す
+func (r *Repository) RenameTag(ctx context.Context, oldTag string, newTag string, userName string) ([]BulkResult, error) {
+	count, err := r.countTag(ctx, newTag)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrTagExists
+	}
+
+	return r.MergeTag(ctx, oldTag, newTag, userName)
+}
+
+// MergeTag タグoldTagが付いたノートのタグをnewTagに付け替える
+// 本文中のfront matterとタグ行も書き換え，ノートごとに新しいリビジョンを作る
+// 同義語はすべてのノートを付け替えられた場合だけ移す．失敗したノートにはoldTagが残るため，MergeTagをやり直せば続きから付け替える
+func (r *Repository) MergeTag(ctx context.Context, oldTag string, newTag string, userName string) ([]BulkResult, error) {
+	noteIDs, err := r.tagNoteIDs(ctx, oldTag)
+	if err != nil {
+		return nil, err
+	}
+	if len(noteIDs) == 0 {
+		return nil, ErrTagNotFound
+	}
+
+	results := make([]BulkResult, 0, len(noteIDs))
+	failed := false
+	for _, noteID := range noteIDs {
+		result := BulkResult{NoteID: noteID, Status: BulkStatusOK}
+		if err := r.retagNote(ctx, noteID, oldTag, newTag, userName); err != nil {
+			result.Status = BulkStatusError
+			result.Error = bulkErrorReason(noteID, err)
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	if !failed {
+		if err := r.renameTagSynonym(ctx, oldTag, newTag); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// tagNoteIDs タグが付いたノートのIDをすべて取得する
+func (r *Repository) tagNoteIDs(ctx context.Context, tag string) ([]string, error) {
+	query := tagQuery(tag)
+	sort := &mySortCombinations{sortCombinations: types.SortOptions{SortOptions: map[string]types.FieldSort{"id.keyword": {Order: &sortorder.Asc}}}}
+
+	noteIDs := []string{}
+	var after []types.FieldValueVariant
+	for {
+		req := r.es.Search().Index("notes").Query(&query).Sort(sort).Source_(&types.SourceFilter{Includes: []string{"id"}}).Size(tagPageSize)
+		if after != nil {
+			req = req.SearchAfter(after...)
+		}
+		res, err := req.Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("search notes in ES: %w", err)
+		}
+		if len(res.Hits.Hits) == 0 {
+			return noteIDs, nil
+		}
+
+		for _, hit := range res.Hits.Hits {
+			var doc struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(hit.Source_, &doc); err != nil {
+				return nil, fmt.Errorf("unmarshal note data: %w", err)
+			}
+			noteIDs = append(noteIDs, doc.ID)
+		}
+
+		last := res.Hits.Hits[len(res.Hits.Hits)-1]
+		after = make([]types.FieldValueVariant, 0, len(last.Sort))
+		for _, v := range last.Sort {
+			after = append(after, &myFieldValue{fieldValue: v})
+		}
+	}
+}
+
+// retagNote ノートのタグoldTagをnewTagに付け替えた新しいリビジョンを作る
+func (r *Repository) retagNote(ctx context.Context, noteID string, oldTag string, newTag string, userName string) error {
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return fmt.Errorf("parse note ID: %w", err)
+	}
+	note, err := r.getNoteDocument(ctx, noteID)
+	if err != nil {
+		return err
+	}
+	channelID, err := uuid.Parse(note.Channel)
+	if err != nil {
+		return fmt.Errorf("parse channel ID: %w", err)
+	}
+	revisionID, _ := uuid.Parse(note.LatestRevision)
+
+	tags := make([]string, 0, len(note.Tag))
+	for _, tag := range note.Tag {
+		if tag == oldTag {
+			tag = newTag
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return r.UpdateNote(ctx, id, UpdateNoteParams{
+		UserName:   userName,
+		Channel:    channelID,
+		Permission: note.Permission,
+		Revision:   revisionID,
+		Body:       notebody.RenameTag(note.Body, oldTag, newTag),
+		Tags:       tags,
+		Title:      note.Title,
+		Summary:    note.Summary,
+	})
+}
+
+// renameTagSynonym 名前を変えたタグの同義語を新しい名前に引き継ぐ
+// 新しい名前のタグに既に同義語がある場合は，そちらを残す
+func (r *Repository) renameTagSynonym(_ context.Context, oldTag string, newTag string) error {
+	if _, err := r.db.Exec(`UPDATE IGNORE tag_synonyms SET tag = ? WHERE tag = ?`, newTag, oldTag); err != nil {
+		return fmt.Errorf("rename tag synonym: %w", err)
+	}
+	if _, err := r.db.Exec(`DELETE FROM tag_synonyms WHERE tag = ?`, oldTag); err != nil {
+		return fmt.Errorf("delete tag synonym: %w", err)
+	}
+
+	return nil
+}
+
+// tagSynonyms タグごとの同義語を取得する
+func (r *Repository) tagSynonyms(_ context.Context, tags []string) (map[string][]string, error) {
+	synonyms := map[string][]string{}
+	if len(tags) == 0 {
+		return synonyms, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT s.tag, o.tag AS synonym FROM tag_synonyms s
+		JOIN tag_synonyms o ON o.group_id = s.group_id AND o.tag <> s.tag
+		WHERE s.tag IN (?) ORDER BY o.tag`, tags)
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	rows := []struct {
+		Tag     string `db:"tag"`
+		Synonym string `db:"synonym"`
+	}{}
+	if err := r.db.Select(&rows, r.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("select tag synonyms: %w", err)
+	}
+	for _, row := range rows {
+		synonyms[row.Tag] = append(synonyms[row.Tag], row.Synonym)
+	}
+
+	return synonyms, nil
+}
+
+// GetTagSynonyms タグの同義語を取得する
+func (r *Repository) GetTagSynonyms(ctx context.Context, tag string) ([]string, error) {
+	synonyms, err := r.tagSynonyms(ctx, []string{tag})
+	if err != nil {
+		return nil, err
+	}
+	if synonyms[tag] == nil {
+		return []string{}, nil
+	}
+
+	return synonyms[tag], nil
+}
+
+// SetTagSynonyms タグの同義語をsynonymsに置き換える
+// 他のタグの同義語になっていたタグは，そのグループから外してこのタグのグループに入れる
+func (r *Repository) SetTagSynonyms(_ context.Context, tag string, synonyms []string) error {
+	group := []string{tag}
+	for _, synonym := range synonyms {
+		if !slices.Contains(group, synonym) {
+			group = append(group, synonym)
+		}
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var groupID string
+	err = tx.Get(&groupID, `SELECT group_id FROM tag_synonyms WHERE tag = ?`, tag)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("select tag synonym group: %w", err)
+	}
+	if groupID != "" {
+		if _, err := tx.Exec(`DELETE FROM tag_synonyms WHERE group_id = ?`, groupID); err != nil {
+			return fmt.Errorf("delete tag synonyms: %w", err)
+		}
+	} else {
+		id, _ := uuid.NewV7()
+		groupID = id.String()
+	}
+	query, args, err := sqlx.In(`DELETE FROM tag_synonyms WHERE tag IN (?)`, group)
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+	if _, err := tx.Exec(tx.Rebind(query), args...); err != nil {
+		return fmt.Errorf("delete tag synonyms: %w", err)
+	}
+
+	// 同義語がない場合はグループを作らない
+	if len(group) > 1 {
+		for _, t := range group {
+			if _, err := tx.Exec(`INSERT INTO tag_synonyms (tag, group_id) VALUES (?, ?)`, t, groupID); err != nil {
+				return fmt.Errorf("insert tag synonym: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTagSynonyms タグを同義語のグループから外す
+// グループに残るタグが1つになった場合はグループごと削除する
+func (r *Repository) DeleteTagSynonyms(_ context.Context, tag string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var groupID string
+	err = tx.Get(&groupID, `SELECT group_id FROM tag_synonyms WHERE tag = ?`, tag)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("select tag synonym group: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM tag_synonyms WHERE tag = ?`, tag); err != nil {
+		return fmt.Errorf("delete tag synonym: %w", err)
+	}
+	var remaining int
+	if err := tx.Get(&remaining, `SELECT COUNT(*) FROM tag_synonyms WHERE group_id = ?`, groupID); err != nil {
+		return fmt.Errorf("count tag synonyms: %w", err)
+	}
+	if remaining < 2 {
+		if _, err := tx.Exec(`DELETE FROM tag_synonyms WHERE group_id = ?`, groupID); err != nil {
+			return fmt.Errorf("delete tag synonym group: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// withTagSynonyms 検索条件のタグの同義語を設定する
+func (r *Repository) withTagSynonyms(ctx context.Context, params GetNotesParams) (GetNotesParams, error) {
+	synonyms, err := r.tagSynonyms(ctx, slices.Concat(params.Tags, params.NotTags))
+	if err != nil {
+		return params, err
+	}
+	params.TagSynonyms = synonyms
+
+	return params, nil
+}
+
+// tagFilterQuery タグの検索条件．同義語がある場合はいずれかのタグが付いたノートに一致させる
+// literalモードで末尾が`/`のタグは，そのタグと子孫のタグのいずれかが付いたノートに一致させる
+func tagFilterQuery(tag string, mode string, synonyms []string) types.Query {
+	query := patternQuery("tag.keyword", mode, tag)
+	if (mode == "" || mode == searchpattern.ModeLiteral) && isTagSubtree(tag) {
+		query = tagSubtreeQuery(tag)
+	}
+	if len(synonyms) == 0 {
+		return query
+	}
+
+	should := []types.Query{query}
+	for _, synonym := range synonyms {
+		should = append(should, tagQuery(synonym))
+	}
+
+	return types.Query{
+		Bool: &types.BoolQuery{
+			Should:             should,
+			MinimumShouldMatch: 1,
+		},
+	}
+}
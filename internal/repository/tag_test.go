@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTagFilterQuery(t *testing.T) {
+	tests := []struct {
+		tag      string
+		mode     string
+		synonyms []string
+		want     string
+	}{
+		{tag: "hackathon", want: `{"term":{"tag.keyword":{"value":"hackathon"}}}`},
+		{
+			tag:      "hackathon",
+			mode:     "literal",
+			synonyms: []string{"ハッカソン"},
+			want:     `{"bool":{"minimum_should_match":1,"should":[{"term":{"tag.keyword":{"value":"hackathon"}}},{"term":{"tag.keyword":{"value":"ハッカソン"}}}]}}`,
+		},
+		{tag: "sysad/", want: `{"term":{"tagPaths":{"value":"sysad/"}}}`},
+		{tag: "/", want: `{"term":{"tag.keyword":{"value":"/"}}}`},
+		{tag: "sysad/", mode: "prefix", want: `{"prefix":{"tag.keyword":{"value":"sysad/"}}}`},
+		{tag: "hack.*", mode: "regex", want: `{"regexp":{"tag.keyword":{"flags":"NONE","max_determinized_states":10000,"value":"hack.*"}}}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(tagFilterQuery(tt.tag, tt.mode, tt.synonyms))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("tagFilterQuery(%q, %q, %v) = %s, want %s", tt.tag, tt.mode, tt.synonyms, b, tt.want)
+		}
+	}
+}
+
+func TestTagPaths(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{tags: nil, want: []string{}},
+		{tags: []string{"hackathon"}, want: []string{"hackathon/"}},
+		{tags: []string{"sysad/infra/k8s"}, want: []string{"sysad/", "sysad/infra/", "sysad/infra/k8s/"}},
+		{tags: []string{"sysad/infra", "sysad/web", "sysad"}, want: []string{"sysad/", "sysad/infra/", "sysad/web/"}},
+		{tags: []string{"sysad/", "/", ""}, want: []string{"sysad/"}},
+	}
+	for _, tt := range tests {
+		if got := tagPaths(tt.tags); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tagPaths(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestBuildTagTree(t *testing.T) {
+	counts := map[string]int64{"sysad/infra/k8s": 2, "sysad": 1, "hackathon": 3}
+	totals := map[string]int64{"sysad": 3, "sysad/infra": 2, "sysad/infra/k8s": 2, "hackathon": 3}
+	want := []TagNode{
+		{Name: "hackathon", Path: "hackathon", Count: 3, Total: 3, Children: []TagNode{}},
+		{Name: "sysad", Path: "sysad", Count: 1, Total: 3, Children: []TagNode{
+			{Name: "infra", Path: "sysad/infra", Count: 0, Total: 2, Children: []TagNode{
+				{Name: "k8s", Path: "sysad/infra/k8s", Count: 2, Total: 2, Children: []TagNode{}},
+			}},
+		}},
+	}
+	if got := buildTagTree(counts, totals); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildTagTree() = %+v, want %+v", got, want)
+	}
+
+	// tagPathsを登録していないノートのタグも木に含める
+	want = []TagNode{
+		{Name: "a", Path: "a", Count: 0, Total: 0, Children: []TagNode{
+			{Name: "b", Path: "a/b", Count: 1, Total: 1, Children: []TagNode{}},
+		}},
+	}
+	if got := buildTagTree(map[string]int64{"a/b": 1}, map[string]int64{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildTagTree() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v9/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v9/typedapi/types/enums/conflicts"
+)
+
+// tagPathsField `/`で区切った階層タグについて，タグ自身とその祖先に`/`を付けて登録するフィールド
+// `sysad/infra/k8s`には`sysad/`，`sysad/infra/`，`sysad/infra/k8s/`を登録する
+const tagPathsField = "tagPaths"
+
+// tagPathsScript tagPathsを持たないノートにtagPathsを登録するスクリプト．tagPathsと同じ値を作る
+const tagPathsScript = `
+def paths = new ArrayList();
+if (ctx._source.tag != null) {
+  for (def tag : ctx._source.tag) {
+    if (tag.endsWith('/')) {
+      tag = tag.substring(0, tag.length() - 1);
+    }
+    if (tag.isEmpty()) {
+      continue;
+    }
+    int i = tag.indexOf('/');
+    while (i >= 0) {
+      def path = tag.substring(0, i + 1);
+      if (!paths.contains(path)) {
+        paths.add(path);
+      }
+      i = tag.indexOf('/', i + 1);
+    }
+    if (!paths.contains(tag + '/')) {
+      paths.add(tag + '/');
+    }
+  }
+}
+ctx._source.tagPaths = paths;
+`
+
+// TagNode 階層タグの木の節
+type TagNode struct {
+	// Name 最後の階層の名前
+	Name string `json:"name"`
+	// Path タグの名前
+	Path string `json:"path"`
+	// Count このタグが付いたノートの数
+	Count int64 `json:"count"`
+	// Total 子孫のタグを含めたいずれかのタグが付いたノートの数
+	Total    int64     `json:"total"`
+	Children []TagNode `json:"children"`
+}
+
+// tagPaths ESのtagPathsに登録する値を返す
+func tagPaths(tags []string) []string {
+	paths := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSuffix(tag, "/")
+		if tag == "" {
+			continue
+		}
+		for i, c := range tag {
+			if c == '/' && !slices.Contains(paths, tag[:i+1]) {
+				paths = append(paths, tag[:i+1])
+			}
+		}
+		if !slices.Contains(paths, tag+"/") {
+			paths = append(paths, tag+"/")
+		}
+	}
+
+	return paths
+}
+
+// isTagSubtree `sysad/`のように末尾が`/`のタグは，そのタグと子孫のタグを表す
+func isTagSubtree(tag string) bool {
+	return len(tag) > 1 && strings.HasSuffix(tag, "/")
+}
+
+// tagSubtreeQuery タグtagとその子孫のタグのいずれかが付いたノートに一致するクエリ．tagの末尾は`/`
+func tagSubtreeQuery(tag string) types.Query {
+	return NewTermQuery(tagPathsField, tag)
+}
+
+// indexTagPaths tagPathsを持たないノートにtagPathsを登録する
+func (r *Repository) indexTagPaths(ctx context.Context) error {
+	query := types.Query{
+		Bool: &types.BoolQuery{
+			Filter:  []types.Query{{Exists: &types.ExistsQuery{Field: "tag"}}},
+			MustNot: []types.Query{{Exists: &types.ExistsQuery{Field: tagPathsField}}},
+		},
+	}
+	_, err := r.es.UpdateByQuery("notes").
+		Query(&query).
+		Conflicts(conflicts.Proceed).
+		Script(&types.Script{Source: tagPathsScript}).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("index tag paths in ES: %w", err)
+	}
+
+	return nil
+}
+
+// GetTagTree ノートに付いているタグを`/`で区切った階層の木として取得する
+func (r *Repository) GetTagTree(ctx context.Context) ([]TagNode, error) {
+	res, err := r.es.Search().Index("notes").Size(0).Aggregations(map[string]types.Aggregations{
+		"tags": {
+			Terms: &types.TermsAggregation{
+				Field: some.String("tag.keyword"),
+				Size:  some.Int(MaxTags),
+			},
+		},
+		"paths": {
+			Terms: &types.TermsAggregation{
+				Field: some.String(tagPathsField),
+				Size:  some.Int(MaxTags),
+			},
+		},
+	}).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate notes by tag in ES: %w", err)
+	}
+
+	counts := map[string]int64{}
+	for _, tag := range termsBuckets(res.Aggregations["tags"]) {
+		counts[tag.Name] = tag.Count
+	}
+	totals := map[string]int64{}
+	for _, path := range termsBuckets(res.Aggregations["paths"]) {
+		totals[strings.TrimSuffix(path.Name, "/")] = path.Count
+	}
+
+	return buildTagTree(counts, totals), nil
+}
+
+// buildTagTree タグごとのノートの数から階層タグの木を作る
+// totalsはtagPathsの集計で，キーの末尾の`/`は除く．集計にない場合はcountsの値を使う
+func buildTagTree(counts map[string]int64, totals map[string]int64) []TagNode {
+	nodes := map[string]*TagNode{}
+	children := map[string][]string{}
+	var add func(path string)
+	add = func(path string) {
+		if _, ok := nodes[path]; ok {
+			return
+		}
+		node := &TagNode{Name: path, Path: path, Count: counts[path], Total: totals[path]}
+		if node.Total < node.Count {
+			node.Total = node.Count
+		}
+		nodes[path] = node
+
+		parent := ""
+		if i := strings.LastIndex(path, "/"); i > 0 {
+			parent = path[:i]
+			node.Name = path[i+1:]
+			add(parent)
+		}
+		children[parent] = append(children[parent], path)
+	}
+	for path := range counts {
+		if path = strings.TrimSuffix(path, "/"); path != "" {
+			add(path)
+		}
+	}
+	for path := range totals {
+		if path != "" {
+			add(path)
+		}
+	}
+
+	var build func(parent string) []TagNode
+	build = func(parent string) []TagNode {
+		paths := children[parent]
+		slices.Sort(paths)
+		res := make([]TagNode, 0, len(paths))
+		for _, path := range paths {
+			node := *nodes[path]
+			node.Children = build(path)
+			res = append(res, node)
+		}
+
+		return res
+	}
+
+	return build("")
+}
+
+// termsBuckets terms集計の結果をタグとノートの数の組に変換する
+func termsBuckets(aggregate types.Aggregate) []TagCount {
+	tags := []TagCount{}
+	agg, ok := aggregate.(*types.StringTermsAggregate)
+	if !ok {
+		return tags
+	}
+	buckets, ok := agg.Buckets.([]types.StringTermsBucket)
+	if !ok {
+		return tags
+	}
+	for _, bucket := range buckets {
+		if name, ok := bucket.Key.(string); ok {
+			tags = append(tags, TagCount{Name: name, Count: bucket.DocCount})
+		}
+	}
+
+	return tags
+}
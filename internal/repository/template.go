@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/traP-jp/circuledge-backend/internal/notetemplate"
+)
+
+const (
+	TemplateScopeUser    = "user"
+	TemplateScopeChannel = "channel"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrTemplateNotAvailable チャンネルのテンプレートをその子孫でないチャンネルで使おうとした
+	ErrTemplateNotAvailable = errors.New("template is not available in the channel")
+)
+
+type (
+	// Template ノートのテンプレート
+	// ユーザー個人のテンプレートは本人だけが，チャンネルのテンプレートはそのチャンネルと子孫チャンネルで誰でも使える
+	Template struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Title string `json:"title"`
+		Body  string `json:"body"`
+		Scope string `json:"scope"`
+		// Channel チャンネルのテンプレートのチャンネル．ユーザー個人のテンプレートは空
+		Channel     string `json:"channel,omitempty"`
+		ChannelPath string `json:"channelPath,omitempty"`
+		// Number 最後に展開した{{number}}の値
+		Number    int    `json:"number"`
+		CreatedBy string `json:"createdBy"`
+		CreatedAt int32  `json:"createdAt"`
+		UpdatedAt int32  `json:"updatedAt"`
+	}
+
+	TemplateParams struct {
+		Name  string
+		Title string
+		Body  string
+		// Channel uuid.Nilの場合はユーザー個人のテンプレートにする
+		Channel uuid.UUID
+	}
+
+	RenderTemplateParams struct {
+		TemplateID string
+		// Variables 組み込みでない変数の値
+		Variables map[string]string
+	}
+
+	templateRow struct {
+		ID        string         `db:"id"`
+		Name      string         `db:"name"`
+		Title     string         `db:"title"`
+		Body      string         `db:"body"`
+		Owner     sql.NullString `db:"owner"`
+		ChannelID sql.NullString `db:"channel_id"`
+		Counter   int            `db:"counter"`
+		CreatedBy string         `db:"created_by"`
+		CreatedAt int32          `db:"created_at"`
+		UpdatedAt int32          `db:"updated_at"`
+	}
+)
+
+const templateColumns = `SELECT id, name, title, body, owner, channel_id, counter, created_by, created_at, updated_at FROM note_templates`
+
+func (row templateRow) template(channelPath func(string) string) Template {
+	t := Template{
+		ID:        row.ID,
+		Name:      row.Name,
+		Title:     row.Title,
+		Body:      row.Body,
+		Scope:     TemplateScopeUser,
+		Number:    row.Counter,
+		CreatedBy: row.CreatedBy,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+	if row.ChannelID.Valid {
+		t.Scope = TemplateScopeChannel
+		t.Channel = row.ChannelID.String
+		t.ChannelPath = channelPath(row.ChannelID.String)
+	}
+
+	return t
+}
+
+// validateTemplate タイトルと本文の変数が正しく書かれているか確かめる
+func validateTemplate(params TemplateParams) error {
+	for _, src := range []string{params.Title, params.Body} {
+		if _, err := notetemplate.Variables(src); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// templateOwner ユーザー個人のテンプレートの所有者とチャンネルのテンプレートのチャンネルの値
+func templateOwner(userName string, channel uuid.UUID) (sql.NullString, sql.NullString) {
+	if channel == uuid.Nil {
+		return sql.NullString{String: userName, Valid: true}, sql.NullString{}
+	}
+
+	return sql.NullString{}, sql.NullString{String: channel.String(), Valid: true}
+}
+
+// CreateTemplate テンプレートを作成する
+func (r *Repository) CreateTemplate(ctx context.Context, userName string, params TemplateParams) (*Template, error) {
+	if err := validateTemplate(params); err != nil {
+		return nil, err
+	}
+
+	id, _ := uuid.NewV7()
+	now := time.Now().Unix()
+	owner, channelID := templateOwner(userName, params.Channel)
+	query := `INSERT INTO note_templates (id, name, title, body, owner, channel_id, counter, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`
+	if _, err := r.db.Exec(query, id, params.Name, params.Title, params.Body, owner, channelID, userName, now, now); err != nil {
+		return nil, fmt.Errorf("insert note template: %w", err)
+	}
+
+	return r.GetTemplate(ctx, id.String(), userName)
+}
+
+// getTemplateRow userNameが使えるテンプレートを取得する
+// 他のユーザーの個人のテンプレートはErrTemplateNotFoundとする
+func (r *Repository) getTemplateRow(templateID string, userName string) (*templateRow, error) {
+	var row templateRow
+	err := r.db.Get(&row, templateColumns+` WHERE id = ?`, templateID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select note template: %w", err)
+	}
+	if row.Owner.Valid && row.Owner.String != userName {
+		return nil, ErrTemplateNotFound
+	}
+
+	return &row, nil
+}
+
+// GetTemplate userNameが使えるテンプレートを取得する
+func (r *Repository) GetTemplate(ctx context.Context, templateID string, userName string) (*Template, error) {
+	row, err := r.getTemplateRow(templateID, userName)
+	if err != nil {
+		return nil, err
+	}
+	t := row.template(r.channelPathResolver(ctx))
+
+	return &t, nil
+}
+
+// GetTemplates userNameが使えるテンプレートを名前順に取得する
+// channelがuuid.Nilでない場合，チャンネルのテンプレートはそのチャンネルで使えるものに絞り込む
+func (r *Repository) GetTemplates(ctx context.Context, userName string, channel uuid.UUID) ([]Template, error) {
+	query, args := templateColumns+` WHERE owner = ? OR channel_id IS NOT NULL ORDER BY name, id`, []any{userName}
+	if channel != uuid.Nil {
+		ancestry, err := r.getChannelAncestry(ctx, channel)
+		if err != nil {
+			return nil, err
+		}
+		query, args, err = sqlx.In(templateColumns+` WHERE owner = ? OR channel_id IN (?) ORDER BY name, id`, userName, ancestry.Ancestors)
+		if err != nil {
+			return nil, fmt.Errorf("build query: %w", err)
+		}
+	}
+
+	rows := []templateRow{}
+	if err := r.db.Select(&rows, r.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("select note templates: %w", err)
+	}
+
+	channelPath := r.channelPathResolver(ctx)
+	templates := make([]Template, 0, len(rows))
+	for _, row := range rows {
+		templates = append(templates, row.template(channelPath))
+	}
+
+	return templates, nil
+}
+
+// UpdateTemplate テンプレートを更新する．作成したユーザーのみ更新できる
+func (r *Repository) UpdateTemplate(ctx context.Context, templateID string, userName string, params TemplateParams) (*Template, error) {
+	row, err := r.getTemplateRow(templateID, userName)
+	if err != nil {
+		return nil, err
+	}
+	if row.CreatedBy != userName {
+		return nil, ErrForbidden
+	}
+	if err := validateTemplate(params); err != nil {
+		return nil, err
+	}
+
+	owner, channelID := templateOwner(userName, params.Channel)
+	query := `UPDATE note_templates SET name = ?, title = ?, body = ?, owner = ?, channel_id = ?, updated_at = ? WHERE id = ?`
+	if _, err := r.db.Exec(query, params.Name, params.Title, params.Body, owner, channelID, time.Now().Unix(), templateID); err != nil {
+		return nil, fmt.Errorf("update note template: %w", err)
+	}
+
+	return r.GetTemplate(ctx, templateID, userName)
+}
+
+// DeleteTemplate テンプレートを削除する．作成したユーザーのみ削除できる
+func (r *Repository) DeleteTemplate(_ context.Context, templateID string, userName string) error {
+	row, err := r.getTemplateRow(templateID, userName)
+	if err != nil {
+		return err
+	}
+	if row.CreatedBy != userName {
+		return ErrForbidden
+	}
+
+	if _, err := r.db.Exec(`DELETE FROM note_templates WHERE id = ?`, templateID); err != nil {
+		return fmt.Errorf("delete note template: %w", err)
+	}
+
+	return nil
+}
+
+// renderTemplate テンプレートのタイトルと本文の変数を展開する
+// {{number}}を使うテンプレートはtxの中で番号を1増やすため，ノートの作成に失敗した場合は番号も進まない
+func (r *Repository) renderTemplate(tx *sqlx.Tx, params RenderTemplateParams, userName string, ancestry channelAncestry) (string, string, error) {
+	row, err := r.getTemplateRow(params.TemplateID, userName)
+	if err != nil {
+		return "", "", err
+	}
+	if row.ChannelID.Valid && !slices.Contains(ancestry.Ancestors, row.ChannelID.String) {
+		return "", "", ErrTemplateNotAvailable
+	}
+
+	// 組み込みの変数はクライアントが指定した値より優先する
+	tc := notetemplate.Context{
+		Now:         time.Now(),
+		ChannelPath: ancestry.Path,
+		Author:      userName,
+		Number:      row.Counter + 1,
+	}
+	vars := map[string]string{}
+	for name, value := range params.Variables {
+		vars[name] = value
+	}
+	render := func() (string, string, error) {
+		for name, value := range tc.Variables() {
+			vars[name] = value
+		}
+		title, err := notetemplate.Render(row.Title, vars)
+		if err != nil {
+			return "", "", err
+		}
+		body, err := notetemplate.Render(row.Body, vars)
+		if err != nil {
+			return "", "", err
+		}
+
+		return title, body, nil
+	}
+
+	// 番号を進める前に展開できることを確かめる
+	title, body, err := render()
+	if err != nil {
+		return "", "", err
+	}
+	if !notetemplate.Uses(row.Title, notetemplate.NumberVariable) && !notetemplate.Uses(row.Body, notetemplate.NumberVariable) {
+		return title, body, nil
+	}
+
+	tc.Number, err = nextTemplateNumber(tx, params.TemplateID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return render()
+}
+
+// nextTemplateNumber テンプレートの番号を1増やして返す．txが終わるまで同じテンプレートの番号はロックされる
+func nextTemplateNumber(tx *sqlx.Tx, templateID string) (int, error) {
+	var number int
+	if err := tx.Get(&number, `SELECT counter FROM note_templates WHERE id = ? FOR UPDATE`, templateID); err != nil {
+		return 0, fmt.Errorf("select note template counter: %w", err)
+	}
+	number++
+	if _, err := tx.Exec(`UPDATE note_templates SET counter = ? WHERE id = ?`, number, templateID); err != nil {
+		return 0, fmt.Errorf("update note template counter: %w", err)
+	}
+
+	return number, nil
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/traP-jp/circuledge-backend/internal/traqbot"
+	traq "github.com/traPtitech/go-traq"
+)
+
+const (
+	traqOrigin = "https://q.trap.jp"
+	// threadMessageLimit スレッドとして保存するメッセージ数の上限
+	threadMessageLimit = 100
+)
+
+var (
+	ErrNothingToSave = errors.New("nothing to save")
+	// ErrMessageOutsideChannel 引用されたメッセージがコマンドのチャンネル以外にある
+	// BOTはすべての公開チャンネルのメッセージを読めるため，コマンドを書いたユーザーが読めないメッセージを保存しないようにする
+	ErrMessageOutsideChannel = errors.New("cited message is outside the command channel")
+)
+
+type SaveTraQMessagesParams struct {
+	// ChannelID コマンドが書かれたチャンネル．ノートもこのチャンネルに作成する
+	ChannelID        string
+	CommandMessageID string
+	Command          traqbot.Command
+	BotName          string
+}
+
+// SaveTraQMessages `@circuledge save`で指定されたtraQのメッセージをノートとして保存し，traQに返信する
+func (r *Repository) SaveTraQMessages(ctx context.Context, params SaveTraQMessagesParams) (uuid.UUID, error) {
+	client, auth := r.traqClient(ctx)
+	command, _, err := client.MessageApi.GetMessage(auth, params.CommandMessageID).Execute()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("get message from traQ: %w", err)
+	}
+
+	var sources []traq.Message
+	switch {
+	case params.Command.Thread:
+		sources, err = r.fetchTraQThread(ctx, command, params.Command.CitedMessageIDs)
+	case len(params.Command.CitedMessageIDs) > 0:
+		sources, err = r.fetchTraQMessages(ctx, params.Command.CitedMessageIDs, command.ChannelId)
+	default:
+		sources = []traq.Message{*command}
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	body, err := r.composeTraQMessages(ctx, sources, command.Id, params.BotName)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	channelID, err := uuid.Parse(params.ChannelID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("parse channel ID: %w", err)
+	}
+	note, err := r.CreateNote(ctx, CreateNoteParams{Channel: channelID, Body: body})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	noteID := note.ID
+
+	if r.notifier == nil {
+		return noteID, nil
+	}
+	botMessageID, err := r.notifier.NotifySaved(ctx, params.ChannelID, noteID.String(), note.Title)
+	if err != nil {
+		return noteID, err
+	}
+
+	sourceIDs := make([]string, 0, len(sources))
+	for _, m := range sources {
+		sourceIDs = append(sourceIDs, m.Id)
+	}
+	query := `INSERT INTO traq_message_notes (bot_message_id, note_id, channel, command_message_id, source_message_ids, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = r.db.Exec(query, botMessageID, noteID, params.ChannelID, command.Id, strings.Join(sourceIDs, ","), time.Now().Unix())
+	if err != nil {
+		return noteID, fmt.Errorf("insert traq message note: %w", err)
+	}
+
+	return noteID, nil
+}
+
+// ResyncTraQMessageNote BOTの返信に更新用のスタンプが押された場合に，元のメッセージの現在の内容でノートを更新する
+// botMessageIDがノートの保存時の返信でない場合は何もしない
+func (r *Repository) ResyncTraQMessageNote(ctx context.Context, botMessageID string, botName string) error {
+	var row struct {
+		NoteID           string `db:"note_id"`
+		Channel          string `db:"channel"`
+		CommandMessageID string `db:"command_message_id"`
+		SourceMessageIDs string `db:"source_message_ids"`
+	}
+	query := `SELECT note_id, channel, command_message_id, source_message_ids FROM traq_message_notes WHERE bot_message_id = ?`
+	err := r.db.Get(&row, query, botMessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("select traq message note: %w", err)
+	}
+
+	sources, err := r.fetchTraQMessages(ctx, strings.Split(row.SourceMessageIDs, ","), row.Channel)
+	if err != nil {
+		return err
+	}
+	body, err := r.composeTraQMessages(ctx, sources, row.CommandMessageID, botName)
+	if err != nil {
+		return err
+	}
+
+	note, err := r.getNoteDocument(ctx, row.NoteID)
+	if err != nil {
+		return err
+	}
+	if note.Body == body {
+		return nil
+	}
+
+	noteID, err := uuid.Parse(row.NoteID)
+	if err != nil {
+		return fmt.Errorf("parse note ID: %w", err)
+	}
+	channelID, _ := uuid.Parse(note.Channel)
+	revisionID, _ := uuid.Parse(note.LatestRevision)
+
+	return r.UpdateNote(ctx, noteID, UpdateNoteParams{
+		Channel:    channelID,
+		Permission: note.Permission,
+		Revision:   revisionID,
+		Body:       body,
+	})
+}
+
+// fetchTraQMessages チャンネルchannelIDにあるメッセージを取得する
+// 他のチャンネルのメッセージが含まれる場合はErrMessageOutsideChannelを返す
+func (r *Repository) fetchTraQMessages(ctx context.Context, messageIDs []string, channelID string) ([]traq.Message, error) {
+	client, auth := r.traqClient(ctx)
+	messages := make([]traq.Message, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		m, _, err := client.MessageApi.GetMessage(auth, id).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("get message %s from traQ: %w", id, err)
+		}
+		if m.ChannelId != channelID {
+			return nil, fmt.Errorf("%w: %s", ErrMessageOutsideChannel, id)
+		}
+		messages = append(messages, *m)
+	}
+
+	return messages, nil
+}
+
+// fetchTraQThread コマンドより前のメッセージを古い順に取得する
+// 引用されたメッセージがあればそこから，なければ直前のthreadMessageLimit件を取得する
+func (r *Repository) fetchTraQThread(ctx context.Context, command *traq.Message, citedMessageIDs []string) ([]traq.Message, error) {
+	client, auth := r.traqClient(ctx)
+	req := client.MessageApi.GetMessages(auth, command.ChannelId).
+		Until(command.CreatedAt).
+		Inclusive(true).
+		Limit(threadMessageLimit)
+
+	if len(citedMessageIDs) > 0 {
+		start, err := r.fetchTraQMessages(ctx, citedMessageIDs[:1], command.ChannelId)
+		if err != nil {
+			return nil, err
+		}
+		req = req.Since(start[0].CreatedAt).Order("asc")
+	} else {
+		req = req.Order("desc")
+	}
+
+	messages, _, err := req.Execute()
+	if err != nil {
+		return nil, fmt.Errorf("get messages from traQ: %w", err)
+	}
+	if len(citedMessageIDs) == 0 {
+		slices.Reverse(messages)
+	}
+
+	return slices.DeleteFunc(messages, func(m traq.Message) bool {
+		return m.Id == command.Id
+	}), nil
+}
+
+// composeTraQMessages メッセージをノートの本文に変換する
+// 複数のメッセージの場合は投稿者ごとに見出しを付ける
+func (r *Repository) composeTraQMessages(ctx context.Context, messages []traq.Message, commandMessageID string, botName string) (string, error) {
+	messages = slices.Clone(messages)
+	for i := range messages {
+		if messages[i].Id == commandMessageID {
+			messages[i].Content = traqbot.StripCommand(messages[i].Content, botName)
+		}
+	}
+	messages = slices.DeleteFunc(messages, func(m traq.Message) bool {
+		return strings.TrimSpace(m.Content) == ""
+	})
+	if len(messages) == 0 {
+		return "", ErrNothingToSave
+	}
+	source := "\n\n---\n" + traqOrigin + "/messages/" + messages[0].Id
+
+	if len(messages) == 1 {
+		return messages[0].Content + source, nil
+	}
+
+	client, auth := r.traqClient(ctx)
+	userNames := map[string]string{}
+	blocks := make([]string, 0, len(messages))
+	for _, m := range messages {
+		name, ok := userNames[m.UserId]
+		if !ok {
+			user, _, err := client.UserApi.GetUser(auth, m.UserId).Execute()
+			if err != nil {
+				return "", fmt.Errorf("get user from traQ: %w", err)
+			}
+			name = user.Name
+			userNames[m.UserId] = name
+		}
+		blocks = append(blocks, fmt.Sprintf("**@%s** %s\n%s", name, m.CreatedAt.Format("2006/01/02 15:04"), m.Content))
+	}
+
+	return strings.Join(blocks, "\n\n") + source, nil
+}
@@ -0,0 +1,109 @@
+// Package searchpattern ノートの検索語の扱い方（検索モード）を解釈し，正規表現を検証する
+//
+// 検索モードは次のとおり
+//
+//   - literal: 検索語をそのまま文字列として扱う
+//   - prefix: 検索語で始まる値に一致させる
+//   - regex: 検索語をESの正規表現として扱う．ESで重くなりうるパターンは受け付けない
+package searchpattern
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"unicode/utf8"
+)
+
+const (
+	ModeLiteral = "literal"
+	ModePrefix  = "prefix"
+	ModeRegex   = "regex"
+)
+
+const (
+	// MaxLength 正規表現の最大の長さ（文字数）
+	MaxLength = 256
+	// MaxRepeat {n,m}で指定できる繰り返しの最大の回数
+	MaxRepeat = 100
+	// MaxNestedRepeat 繰り返しを入れ子にできる最大の深さ
+	MaxNestedRepeat = 2
+)
+
+var (
+	ErrInvalidMode    = errors.New("invalid search mode")
+	ErrInvalidPattern = errors.New("invalid search pattern")
+)
+
+// ParseMode 検索モードを解釈する．空の場合はliteralにする
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return ModeLiteral, nil
+	case ModeLiteral, ModePrefix, ModeRegex:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("%w: %q (must be literal, prefix or regex)", ErrInvalidMode, mode)
+}
+
+// Validate 正規表現がESで安全に実行できるか確かめる
+// ESの正規表現は値全体に一致させるため，^や$は使えない
+func Validate(pattern string) error {
+	if utf8.RuneCountInString(pattern) > MaxLength {
+		return fmt.Errorf("%w: pattern must be at most %d characters", ErrInvalidPattern, MaxLength)
+	}
+	// ESでは"で囲んだ部分を文字列として扱うため，Goの構文と解釈が異なる
+	if hasUnescapedQuote(pattern) {
+		return fmt.Errorf(`%w: escape double quotes as \"`, ErrInvalidPattern)
+	}
+
+	re, err := syntax.Parse(pattern, syntax.POSIX)
+	if err != nil {
+		var syntaxErr *syntax.Error
+		if errors.As(err, &syntaxErr) {
+			return fmt.Errorf("%w: %s: `%s`", ErrInvalidPattern, syntaxErr.Code, syntaxErr.Expr)
+		}
+
+		return fmt.Errorf("%w: %s", ErrInvalidPattern, err)
+	}
+
+	return validate(re, 0)
+}
+
+func validate(re *syntax.Regexp, depth int) error {
+	switch re.Op {
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return fmt.Errorf("%w: anchors (^ and $) are not supported; patterns always match the whole value", ErrInvalidPattern)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		depth++
+		if depth > MaxNestedRepeat {
+			return fmt.Errorf("%w: repetitions must not be nested more than %d levels", ErrInvalidPattern, MaxNestedRepeat)
+		}
+		if re.Op == syntax.OpRepeat && (re.Max > MaxRepeat || re.Min > MaxRepeat) {
+			return fmt.Errorf("%w: repetition count must be at most %d", ErrInvalidPattern, MaxRepeat)
+		}
+	}
+	for _, sub := range re.Sub {
+		if err := validate(sub, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hasUnescapedQuote(pattern string) bool {
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return true
+		}
+	}
+
+	return false
+}
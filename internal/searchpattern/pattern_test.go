@@ -0,0 +1,64 @@
+package searchpattern
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{mode: "", want: ModeLiteral},
+		{mode: "literal", want: ModeLiteral},
+		{mode: "prefix", want: ModePrefix},
+		{mode: "regex", want: ModeRegex},
+		{mode: "Regex", wantErr: true},
+		{mode: "glob", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{pattern: "foo", wantErr: false},
+		{pattern: ".*合宿.*", wantErr: false},
+		{pattern: "(foo|bar)+[0-9]{1,4}", wantErr: false},
+		{pattern: `a\.b\"c\\`, wantErr: false},
+		{pattern: "(a+)+", wantErr: false},
+		{pattern: "((a+)+)+", wantErr: true},
+		{pattern: "a{1,1000}", wantErr: true},
+		{pattern: "(foo", wantErr: true},
+		{pattern: "[a-", wantErr: true},
+		{pattern: "*foo", wantErr: true},
+		{pattern: "^foo$", wantErr: true},
+		{pattern: `\d+`, wantErr: true},
+		{pattern: `"foo"`, wantErr: true},
+		{pattern: `\\"`, wantErr: true},
+		{pattern: string(make([]byte, MaxLength+1)), wantErr: true},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.pattern)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("Validate(%q) error = %v, want ErrInvalidPattern", tt.pattern, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// extractDOCX word/document.xmlの段落ごとのテキストを取り出す
+func extractDOCX(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open docx: %w", err)
+	}
+	f, err := zr.Open("word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("open docx document: %w", err)
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	inText := false
+	dec := xml.NewDecoder(io.LimitReader(f, 64<<20))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("parse docx document: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteString("\t")
+			case "br", "cr":
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch tok.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(tok)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
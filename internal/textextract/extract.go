@@ -0,0 +1,78 @@
+// Package textextract 添付ファイルから検索用のテキストを取り出す
+package textextract
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/traP-jp/circuledge-backend/internal/attachment"
+)
+
+// MaxTextLength 取り出すテキストの最大文字数．超えた分は検索の対象にしない
+const MaxTextLength = 100_000
+
+var ErrUnsupported = errors.New("text extraction is not supported for this type")
+
+// OCR 画像から文字を認識する
+type OCR interface {
+	Recognize(ctx context.Context, contentType string, data []byte) (string, error)
+}
+
+type Extractor struct {
+	ocr OCR
+}
+
+// New ocrがnilの場合，画像からはテキストを取り出さない
+func New(ocr OCR) *Extractor {
+	return &Extractor{ocr: ocr}
+}
+
+// Extract ファイルの種類に応じてテキストを取り出す
+// 対応していない種類の場合はErrUnsupportedを返す
+func (e *Extractor) Extract(ctx context.Context, contentType string, data []byte) (string, error) {
+	var text string
+	var err error
+	switch {
+	case contentType == "text/plain":
+		if !utf8.Valid(data) {
+			return "", ErrUnsupported
+		}
+		text = string(data)
+	case contentType == attachment.ContentTypePDF:
+		text, err = extractPDF(data)
+	case contentType == attachment.ContentTypeDOCX:
+		text, err = extractDOCX(data)
+	case strings.HasPrefix(contentType, "image/") && e.ocr != nil:
+		text, err = e.ocr.Recognize(ctx, contentType, data)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return truncate(normalizeSpace(text), MaxTextLength), nil
+}
+
+// normalizeSpace 行ごとに連続する空白を1つにまとめ，空行を取り除く
+func normalizeSpace(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+
+	return s
+}
@@ -0,0 +1,135 @@
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/traP-jp/circuledge-backend/internal/attachment"
+)
+
+// fakeOCR 画像の内容によらず決まった文字列を返す
+type fakeOCR struct {
+	text string
+}
+
+func (o fakeOCR) Recognize(_ context.Context, _ string, _ []byte) (string, error) {
+	return o.text, nil
+}
+
+func testDOCX(t *testing.T, document string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(document)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func testPDF(t *testing.T, content string, compress bool) []byte {
+	t.Helper()
+	stream := []byte(content)
+	filter := ""
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(stream); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		stream = buf.Bytes()
+		filter = " /Filter /FlateDecode"
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d%s >>\nstream\n", len(stream), filter)
+	pdf.Write(stream)
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+
+	return pdf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	pdfContent := `BT /F1 12 Tf 72 712 Td (Hello, \(PDF\)) Tj 0 -14 Td [(Kerned)-300(Words)] TJ T* <FEFF65E5672C8A9E> Tj ET`
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		ocr         OCR
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "text",
+			contentType: "text/plain",
+			data:        []byte("議事録\n\n  メモ   です\n"),
+			want:        "議事録\nメモ です",
+		},
+		{
+			name:        "pdf",
+			contentType: attachment.ContentTypePDF,
+			data:        testPDF(t, pdfContent, false),
+			want:        "Hello, (PDF)\nKerned Words\n日本語",
+		},
+		{
+			name:        "compressed pdf",
+			contentType: attachment.ContentTypePDF,
+			data:        testPDF(t, pdfContent, true),
+			want:        "Hello, (PDF)\nKerned Words\n日本語",
+		},
+		{
+			name:        "docx",
+			contentType: attachment.ContentTypeDOCX,
+			data: testDOCX(t, `<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`+
+				`<w:p><w:r><w:t>合宿の</w:t></w:r><w:r><w:t xml:space="preserve">しおり</w:t></w:r></w:p>`+
+				`<w:p><w:r><w:t>集合</w:t><w:tab/><w:t>9:00</w:t></w:r></w:p></w:body></w:document>`),
+			want: "合宿のしおり\n集合 9:00",
+		},
+		{
+			name:        "image with ocr",
+			contentType: "image/png",
+			data:        []byte("png"),
+			ocr:         fakeOCR{text: "ホワイトボード"},
+			want:        "ホワイトボード",
+		},
+		{
+			name:        "image without ocr",
+			contentType: "image/png",
+			data:        []byte("png"),
+			wantErr:     ErrUnsupported,
+		},
+		{
+			name:        "zip",
+			contentType: "application/zip",
+			data:        []byte("PK"),
+			wantErr:     ErrUnsupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.ocr).Extract(context.Background(), tt.contentType, tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Extract() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package textextract
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// CommandOCR 標準入力から画像を受け取り，標準出力に認識した文字を書き出すコマンドで文字を認識する
+// 例：`tesseract stdin stdout -l jpn+eng`
+type CommandOCR struct {
+	Command string
+	Args    []string
+}
+
+func (o *CommandOCR) Recognize(ctx context.Context, _ string, data []byte) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, o.Command, o.Args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("run ocr command: %w: %s", err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
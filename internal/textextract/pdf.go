@@ -0,0 +1,297 @@
+package textextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxPDFStreamSize 展開するストリームの最大バイト数
+const maxPDFStreamSize = 16 << 20
+
+var (
+	pdfStreamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	pdfSkipPattern   = regexp.MustCompile(`/Subtype\s*/Image|/FontFile|/Type\s*/XRef|/Type\s*/ObjStm`)
+)
+
+// extractPDF ページの内容ストリームのテキスト表示演算子から文字列を取り出す
+// フォントのエンコーディングは解釈しないため，1バイトの文字とUTF-16BEの文字列のみを取り出す
+func extractPDF(data []byte) (string, error) {
+	var b strings.Builder
+	for _, loc := range pdfStreamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 || pdfSkipPattern.Match(dict) {
+			continue
+		}
+		stream := data[start : start+end]
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			r, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			stream, err = io.ReadAll(io.LimitReader(r, maxPDFStreamSize))
+			r.Close()
+			if err != nil && len(stream) == 0 {
+				continue
+			}
+		}
+		if !bytes.Contains(stream, []byte("BT")) {
+			continue
+		}
+		b.WriteString(pdfContentText(stream))
+	}
+
+	return b.String(), nil
+}
+
+// pdfContentText 内容ストリームのBTからETまでのTj・TJ・'・"演算子の文字列を取り出す
+func pdfContentText(content []byte) string {
+	var b strings.Builder
+	var operands []any
+	var array []any
+	inArray := false
+	inText := false
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case isPDFSpace(c):
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := readPDFLiteral(content[i:])
+			i += n
+			if inArray {
+				array = append(array, s)
+			} else {
+				operands = append(operands, s)
+			}
+		case c == '<' && i+1 < len(content) && content[i+1] == '<':
+			i += 2
+		case c == '>' && i+1 < len(content) && content[i+1] == '>':
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return b.String()
+			}
+			s := decodePDFHex(content[i+1 : i+end])
+			i += end + 1
+			if inArray {
+				array = append(array, s)
+			} else {
+				operands = append(operands, s)
+			}
+		case c == '[':
+			inArray, array = true, nil
+			i++
+		case c == ']':
+			inArray = false
+			operands = append(operands, array)
+			i++
+		default:
+			start := i
+			for i < len(content) && !isPDFSpace(content[i]) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+			if i == start {
+				i++
+
+				continue
+			}
+			token := string(content[start:i])
+			if n, err := strconv.ParseFloat(token, 64); err == nil {
+				if inArray {
+					array = append(array, n)
+				} else {
+					operands = append(operands, n)
+				}
+
+				continue
+			}
+			if strings.HasPrefix(token, "/") {
+				operands = append(operands, token)
+
+				continue
+			}
+
+			switch token {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				b.WriteString("\n")
+			case "Tj":
+				if inText {
+					b.WriteString(lastPDFString(operands))
+				}
+			case "'", `"`:
+				if inText {
+					b.WriteString("\n" + lastPDFString(operands))
+				}
+			case "TJ":
+				if inText && len(operands) > 0 {
+					if items, ok := operands[len(operands)-1].([]any); ok {
+						b.WriteString(pdfArrayText(items))
+					}
+				}
+			case "T*":
+				b.WriteString("\n")
+			case "Td", "TD":
+				// 行が変わる移動だけを改行として扱う
+				if len(operands) >= 2 {
+					if ty, ok := operands[len(operands)-1].(float64); ok && ty != 0 {
+						b.WriteString("\n")
+					}
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+
+	return b.String()
+}
+
+func lastPDFString(operands []any) string {
+	if len(operands) == 0 {
+		return ""
+	}
+	s, _ := operands[len(operands)-1].(string)
+
+	return s
+}
+
+// pdfArrayText TJの配列の文字列をつなげる．大きな字間の調整は空白とみなす
+func pdfArrayText(items []any) string {
+	var b strings.Builder
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			b.WriteString(item)
+		case float64:
+			if item < -200 {
+				b.WriteString(" ")
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// readPDFLiteral 括弧で囲まれた文字列を読み，復号した文字列と読んだバイト数を返す
+func readPDFLiteral(content []byte) (string, int) {
+	var buf []byte
+	depth := 0
+	i := 0
+	for ; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			i++
+			switch e := content[i]; e {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'b':
+				buf = append(buf, '\b')
+			case 'f':
+				buf = append(buf, '\f')
+			case '\r', '\n':
+				// 行の継続
+			default:
+				if '0' <= e && e <= '7' {
+					n := 0
+					j := i
+					for ; j < len(content) && j < i+3 && '0' <= content[j] && content[j] <= '7'; j++ {
+						n = n*8 + int(content[j]-'0')
+					}
+					buf = append(buf, byte(n))
+					i = j - 1
+				} else {
+					buf = append(buf, e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				buf = append(buf, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return decodePDFString(buf), i + 1
+			}
+			buf = append(buf, c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return decodePDFString(buf), i
+}
+
+func decodePDFHex(hex []byte) string {
+	digits := make([]byte, 0, len(hex))
+	for _, c := range hex {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	buf := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return ""
+		}
+		buf = append(buf, byte(n))
+	}
+
+	return decodePDFString(buf)
+}
+
+// decodePDFString UTF-16BE（BOM付き）か1バイトの文字列として解釈する
+// 制御文字を含む場合はフォント固有のグリフIDとみなして捨てる
+func decodePDFString(buf []byte) string {
+	if len(buf) >= 2 && buf[0] == 0xfe && buf[1] == 0xff {
+		units := make([]uint16, 0, len(buf)/2)
+		for i := 2; i+1 < len(buf); i += 2 {
+			units = append(units, uint16(buf[i])<<8|uint16(buf[i+1]))
+		}
+
+		return string(utf16.Decode(units))
+	}
+
+	runes := make([]rune, 0, len(buf))
+	for _, c := range buf {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return ""
+		}
+		runes = append(runes, rune(c))
+	}
+
+	return string(runes)
+}
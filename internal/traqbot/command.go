@@ -0,0 +1,54 @@
+package traqbot
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UpdateStampName BOTの返信にこのスタンプを押すと，保存したノートを元メッセージの内容で更新する
+const UpdateStampName = "arrows_counterclockwise"
+
+// Command `@circuledge save [thread]` コマンド
+type Command struct {
+	// Thread メッセージ単体ではなくスレッド全体を保存するかどうか
+	Thread bool
+	// Rest メッセージからコマンド部分を取り除いた残りの本文
+	Rest string
+	// CitedMessageIDs メッセージ中で引用されているtraQメッセージのUUID
+	CitedMessageIDs []string
+}
+
+var messageLinkPattern = regexp.MustCompile(`https?://[^\s/]+/messages/([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})`)
+
+func commandPattern(botName string) *regexp.Regexp {
+	name := regexp.QuoteMeta(botName)
+	// メンションは本文中では `!{"type":"user","raw":"@name",...}` という埋め込みになっている
+	return regexp.MustCompile(`(?i)(?:!\{"type":"user","raw":"@` + name + `"[^}]*\}|@` + name + `)\s+save(\s+thread)?\b`)
+}
+
+// ParseCommand メッセージ本文からBOTへのコマンドを取り出す
+// 本文はtraQの埋め込みを含む生のテキストでもプレーンテキストでもよい
+func ParseCommand(text string, botName string) (Command, bool) {
+	pattern := commandPattern(botName)
+	loc := pattern.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return Command{}, false
+	}
+
+	rest := strings.TrimSpace(text[:loc[0]] + text[loc[1]:])
+	cited := []string{}
+	for _, m := range messageLinkPattern.FindAllStringSubmatch(rest, -1) {
+		cited = append(cited, strings.ToLower(m[1]))
+	}
+
+	return Command{
+		Thread:          loc[2] >= 0,
+		Rest:            rest,
+		CitedMessageIDs: cited,
+	}, true
+}
+
+// StripCommand メッセージ本文からコマンド部分を取り除く
+func StripCommand(text string, botName string) string {
+	return strings.TrimSpace(commandPattern(botName).ReplaceAllString(text, ""))
+}
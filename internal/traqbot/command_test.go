@@ -0,0 +1,39 @@
+package traqbot
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	const link = "https://q.trap.jp/messages/0197882d-208b-7c5a-bf60-89eafb904106"
+	tests := []struct {
+		name   string
+		text   string
+		ok     bool
+		thread bool
+		rest   string
+		cited  []string
+	}{
+		{"plain text", "@circuledge save 今日の議事録", true, false, "今日の議事録", []string{}},
+		{"embedded mention", `!{"type":"user","raw":"@circuledge","id":"0197882d-208b-7c5a-bf60-89eafb904107"} save メモ`, true, false, "メモ", []string{}},
+		{"thread", "@circuledge save thread", true, true, "", []string{}},
+		{"cited message", "@Circuledge SAVE " + link, true, false, link, []string{"0197882d-208b-7c5a-bf60-89eafb904106"}},
+		{"other command", "@circuledge saved", false, false, "", nil},
+		{"other bot", "@BOT_traQ save", false, false, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseCommand(tt.text, "circuledge")
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Thread != tt.thread || got.Rest != tt.rest || !slices.Equal(got.CitedMessageIDs, tt.cited) {
+				t.Errorf("ParseCommand() = %+v, want thread=%v rest=%q cited=%v", got, tt.thread, tt.rest, tt.cited)
+			}
+		})
+	}
+}
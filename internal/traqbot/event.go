@@ -0,0 +1,56 @@
+package traqbot
+
+import "time"
+
+// traQ BOTのHTTPモードで送られてくるヘッダー
+const (
+	HeaderEvent     = "X-TRAQ-BOT-EVENT"
+	HeaderToken     = "X-TRAQ-BOT-TOKEN"
+	HeaderRequestID = "X-TRAQ-BOT-REQUEST-ID"
+)
+
+// BOTが処理するイベントの種類
+const (
+	EventPing                    = "PING"
+	EventMessageCreated          = "MESSAGE_CREATED"
+	EventBotMessageStampsUpdated = "BOT_MESSAGE_STAMPS_UPDATED"
+)
+
+type (
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+		Bot         bool   `json:"bot"`
+	}
+
+	Message struct {
+		ID        string    `json:"id"`
+		User      User      `json:"user"`
+		ChannelID string    `json:"channelId"`
+		Text      string    `json:"text"`
+		PlainText string    `json:"plainText"`
+		CreatedAt time.Time `json:"createdAt"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+
+	// MessageCreatedPayload MESSAGE_CREATEDイベントのペイロード
+	MessageCreatedPayload struct {
+		EventTime time.Time `json:"eventTime"`
+		Message   Message   `json:"message"`
+	}
+
+	Stamp struct {
+		StampID   string `json:"stampId"`
+		UserID    string `json:"userId"`
+		StampName string `json:"stampName"`
+		Count     int    `json:"count"`
+	}
+
+	// BotMessageStampsUpdatedPayload BOT_MESSAGE_STAMPS_UPDATEDイベントのペイロード
+	BotMessageStampsUpdatedPayload struct {
+		EventTime time.Time `json:"eventTime"`
+		MessageID string    `json:"messageId"`
+		Stamps    []Stamp   `json:"stamps"`
+	}
+)
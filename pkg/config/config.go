@@ -3,8 +3,12 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/elastic/go-elasticsearch/v9"
 	"github.com/go-sql-driver/mysql"
+	"github.com/traP-jp/circuledge-backend/internal/blobstore"
 )
 
 func getEnv(key, defaultValue string) string {
@@ -20,6 +24,91 @@ func AppAddr() string {
 	return getEnv("APP_ADDR", ":8080")
 }
 
+// BotAccessToken traQ BOTのアクセストークン
+func BotAccessToken() string {
+	return getEnv("BOT_ACCESS_TOKEN", "")
+}
+
+// ChannelSyncInterval traQのチャンネル構成をノートの検索インデックスに反映する間隔
+func ChannelSyncInterval() time.Duration {
+	d, err := time.ParseDuration(getEnv("CHANNEL_SYNC_INTERVAL", "10m"))
+	if err != nil || d <= 0 {
+		return 10 * time.Minute
+	}
+
+	return d
+}
+
+// AppURL traQへの告知に載せるフロントエンドのURL
+func AppURL() string {
+	return getEnv("APP_URL", "https://circuledge.trap.show")
+}
+
+// NotificationRetryInterval 未送信や送信に失敗したtraQへの告知をまとめて送信し直す間隔
+func NotificationRetryInterval() time.Duration {
+	d, err := time.ParseDuration(getEnv("NOTIFICATION_RETRY_INTERVAL", "5m"))
+	if err != nil || d <= 0 {
+		return 5 * time.Minute
+	}
+
+	return d
+}
+
+// AttachmentTextInterval 添付ファイルからのテキストの取り出しやESへの登録を処理し直す間隔
+func AttachmentTextInterval() time.Duration {
+	d, err := time.ParseDuration(getEnv("ATTACHMENT_TEXT_INTERVAL", "5m"))
+	if err != nil || d <= 0 {
+		return 5 * time.Minute
+	}
+
+	return d
+}
+
+// BotName traQ BOTのtraQ ID
+func BotName() string {
+	return getEnv("BOT_NAME", "circuledge")
+}
+
+// BotVerificationToken traQ BOTのVerification Token
+func BotVerificationToken() string {
+	return getEnv("BOT_VERIFICATION_TOKEN", "")
+}
+
+// BlobStoreType 添付ファイルの保存先（localまたはs3）
+func BlobStoreType() string {
+	return getEnv("BLOB_STORE", "local")
+}
+
+// BlobDir BLOB_STOREがlocalの場合に添付ファイルを保存するディレクトリ
+func BlobDir() string {
+	return getEnv("BLOB_DIR", "./data/attachments")
+}
+
+// S3 BLOB_STOREがs3の場合に添付ファイルを保存するS3互換のオブジェクトストレージ
+func S3() blobstore.S3Config {
+	return blobstore.S3Config{
+		Endpoint:  getEnv("S3_ENDPOINT", "http://minio:9000"),
+		Bucket:    getEnv("S3_BUCKET", "circuledge"),
+		Region:    getEnv("S3_REGION", "us-east-1"),
+		AccessKey: getEnv("S3_ACCESS_KEY", ""),
+		SecretKey: getEnv("S3_SECRET_KEY", ""),
+	}
+}
+
+// OCRCommand 添付された画像の文字を認識するコマンドと引数（例：`tesseract stdin stdout -l jpn+eng`）
+// 空の場合は画像の文字を認識しない
+func OCRCommand() []string {
+	return strings.Fields(getEnv("OCR_COMMAND", ""))
+}
+
+func Elasticsearch() elasticsearch.Config {
+	return elasticsearch.Config{
+		Addresses: []string{getEnv("ES_ADDR", "http://elasticsearch:9200")},
+		Username:  "elastic",
+		Password:  getEnv("ELASTIC_PASSWORD", ""),
+	}
+}
+
 func MySQL() *mysql.Config {
 	c := mysql.NewConfig()
 
@@ -0,0 +1,19 @@
+-- +goose Up
+
+-- attachmentsテーブル（ノートに添付されたファイル）
+CREATE TABLE IF NOT EXISTS attachments (
+    id VARCHAR(36) NOT NULL, -- UUIDv7
+    note_id VARCHAR(36) NOT NULL, -- UUIDv7
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(127) NOT NULL,
+    size BIGINT NOT NULL,
+    blob_key VARCHAR(255) NOT NULL, -- BlobStoreでのキー
+    thumbnail_key VARCHAR(255) DEFAULT NULL, -- サムネイルのBlobStoreでのキー．画像以外はNULL
+    uploaded_by VARCHAR(32) NOT NULL, -- アップロードしたユーザーのtraQ ID
+    created_at INT NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_note_id (note_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,7 @@
+-- +goose Up
+
+-- 添付ファイルから取り出した検索用のテキスト．取り出せない種類のファイルはNULL
+ALTER TABLE attachments ADD COLUMN extracted_text MEDIUMTEXT DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE attachments DROP COLUMN extracted_text;
@@ -0,0 +1,36 @@
+-- +goose Up
+
+-- note_comment_threadsテーブル（ノートに付けたコメントのスレッド）
+CREATE TABLE IF NOT EXISTS note_comment_threads (
+    id VARCHAR(36) NOT NULL, -- UUIDv7
+    note_id VARCHAR(36) NOT NULL,
+    revision_id VARCHAR(36) DEFAULT NULL, -- 範囲を指定したときのリビジョン．ノート全体へのコメントはNULL
+    anchor_revision_id VARCHAR(36) DEFAULT NULL, -- anchor_start, anchor_endが指すリビジョン
+    anchor_start INT DEFAULT NULL, -- 本文中の範囲の開始位置（コードポイント単位）
+    anchor_end INT DEFAULT NULL,
+    quote TEXT DEFAULT NULL, -- 範囲の本文
+    orphaned BOOLEAN NOT NULL DEFAULT FALSE, -- 本文の変更により範囲を追従できなくなった
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    resolved_by VARCHAR(32) DEFAULT NULL,
+    resolved_at INT DEFAULT NULL,
+    created_by VARCHAR(32) NOT NULL, -- traQ ID
+    created_at INT NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_note_id (note_id)
+);
+
+-- note_commentsテーブル（スレッドのコメント）
+CREATE TABLE IF NOT EXISTS note_comments (
+    id VARCHAR(36) NOT NULL, -- UUIDv7
+    thread_id VARCHAR(36) NOT NULL,
+    author VARCHAR(32) NOT NULL, -- traQ ID
+    body TEXT NOT NULL,
+    created_at INT NOT NULL,
+    deleted_at INT DEFAULT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_thread_id (thread_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_comments;
+DROP TABLE IF EXISTS note_comment_threads;
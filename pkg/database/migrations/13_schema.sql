@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- note_starsテーブル（ユーザーごとのノートのスター）
+CREATE TABLE IF NOT EXISTS note_stars (
+    user_name VARCHAR(32) NOT NULL, -- traQ ID
+    note_id VARCHAR(36) NOT NULL,
+    created_at INT NOT NULL,
+    PRIMARY KEY (user_name, note_id),
+    INDEX idx_note_id (note_id)
+);
+
+-- channel_pinsテーブル（チャンネルにピン留めしたノート）
+CREATE TABLE IF NOT EXISTS channel_pins (
+    channel_id VARCHAR(36) NOT NULL,
+    note_id VARCHAR(36) NOT NULL,
+    pinned_by VARCHAR(32) NOT NULL, -- traQ ID
+    created_at INT NOT NULL,
+    PRIMARY KEY (channel_id, note_id),
+    INDEX idx_note_id (note_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS channel_pins;
+DROP TABLE IF EXISTS note_stars;
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- note_templatesテーブル（ノートのテンプレート）
+-- ユーザー個人のテンプレートはowner，チャンネルのテンプレートはchannel_idを設定する
+CREATE TABLE IF NOT EXISTS note_templates (
+    id VARCHAR(36) NOT NULL, -- UUIDv7
+    name VARCHAR(255) NOT NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '', -- 空の場合は本文からタイトルを導出する
+    body TEXT NOT NULL,
+    owner VARCHAR(32) DEFAULT NULL, -- traQ ID
+    channel_id VARCHAR(36) DEFAULT NULL, -- 子孫チャンネルでも使える
+    counter INT NOT NULL DEFAULT 0, -- {{number}}を展開した回数
+    created_by VARCHAR(32) NOT NULL, -- traQ ID
+    created_at INT NOT NULL,
+    updated_at INT NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_owner (owner),
+    INDEX idx_channel_id (channel_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_templates;
@@ -0,0 +1,13 @@
+-- +goose Up
+
+-- tag_synonymsテーブル（同じ意味のタグのグループ）
+-- 同じgroup_idのタグは検索時に互いに展開される
+CREATE TABLE IF NOT EXISTS tag_synonyms (
+    tag VARCHAR(255) NOT NULL,
+    group_id VARCHAR(36) NOT NULL, -- UUIDv7
+    PRIMARY KEY (tag),
+    INDEX idx_group_id (group_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS tag_synonyms;
@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- 添付ファイルからのテキストの取り出しはアップロードとは別にバックグラウンドで行う
+-- pending: 未処理，extracted: extracted_textに保存済みでESには未登録，indexed: ESに登録済み
+-- unsupported: テキストを取り出せない種類のファイル，failed: 取り出しに失敗した（text_attemptsまで再試行する）
+ALTER TABLE attachments
+    ADD COLUMN text_status ENUM('pending', 'extracted', 'indexed', 'unsupported', 'failed') NOT NULL DEFAULT 'pending',
+    ADD COLUMN text_attempts INT NOT NULL DEFAULT 0,
+    ADD INDEX idx_text_status (text_status);
+UPDATE attachments SET text_status = 'indexed' WHERE extracted_text IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE attachments
+    DROP INDEX idx_text_status,
+    DROP COLUMN text_attempts,
+    DROP COLUMN text_status;
@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- note_notificationsテーブル（traQへのノート告知の配信ログ）
+CREATE TABLE IF NOT EXISTS note_notifications (
+    id VARCHAR(36) NOT NULL, -- UUIDv7
+    note_id VARCHAR(36) NOT NULL, -- UUIDv7
+    revision_id VARCHAR(36) NOT NULL, -- UUIDv7
+    channel VARCHAR(36) NOT NULL, -- UUID
+    message_id VARCHAR(36) DEFAULT NULL, -- 投稿したtraQメッセージのUUID
+    published BOOLEAN NOT NULL, -- 公開による告知かどうか
+    status ENUM('pending', 'sent', 'failed', 'cancelled') NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at INT NOT NULL,
+    updated_at INT NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_note_id_channel (note_id, channel),
+    INDEX idx_status (status)
+);
+
+-- note_notification_settingsテーブル（ノートごとの告知設定、行がなければ告知する）
+CREATE TABLE IF NOT EXISTS note_notification_settings (
+    note_id VARCHAR(36) NOT NULL, -- UUIDv7
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (note_id)
+);
+
+-- user_notification_settingsテーブル（ユーザーごとの告知設定、行がなければ告知する）
+CREATE TABLE IF NOT EXISTS user_notification_settings (
+    user_name VARCHAR(255) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_name)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_notification_settings;
+DROP TABLE IF EXISTS note_notification_settings;
+DROP TABLE IF EXISTS note_notifications;
@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- traq_message_notesテーブル（traQのメッセージから作成したノート）
+CREATE TABLE IF NOT EXISTS traq_message_notes (
+    bot_message_id VARCHAR(36) NOT NULL, -- BOTが返信したtraQメッセージのUUID
+    note_id VARCHAR(36) NOT NULL, -- UUIDv7
+    channel VARCHAR(36) NOT NULL, -- UUID
+    command_message_id VARCHAR(36) NOT NULL, -- `@circuledge save`が書かれたtraQメッセージのUUID
+    source_message_ids TEXT NOT NULL, -- ノートにしたtraQメッセージのUUID（カンマ区切り、古い順）
+    created_at INT NOT NULL,
+    PRIMARY KEY (bot_message_id),
+    INDEX idx_note_id (note_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS traq_message_notes;
@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- note_revision_referencesテーブル（リビジョンの本文中のtraQのユーザー・チャンネルなどへの参照）
+CREATE TABLE IF NOT EXISTS note_revision_references (
+    revision_id VARCHAR(36) NOT NULL, -- UUIDv7
+    note_id VARCHAR(36) NOT NULL, -- UUIDv7
+    type ENUM('user', 'group', 'channel', 'message', 'file') NOT NULL,
+    target_id VARCHAR(36) DEFAULT NULL, -- 参照先のUUID（`@name`の形式で書かれた場合はNULL）
+    raw VARCHAR(255) NOT NULL, -- 本文中での表記
+    PRIMARY KEY (revision_id, type, raw),
+    INDEX idx_note_id (note_id),
+    FOREIGN KEY (revision_id) REFERENCES note_revisions(revision_id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_revision_references;
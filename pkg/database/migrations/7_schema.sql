@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- note_import_sourcesテーブル（外部からインポートしたノートの取り込み元）
+CREATE TABLE IF NOT EXISTS note_import_sources (
+    source VARCHAR(64) NOT NULL, -- 取り込み元の種類（hackmdなど）
+    source_id VARCHAR(255) NOT NULL, -- 取り込み元でのID
+    note_id VARCHAR(36) NOT NULL, -- UUIDv7
+    imported_at INT NOT NULL,
+    PRIMARY KEY (source, source_id),
+    INDEX idx_note_id (note_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_import_sources;
@@ -0,0 +1,7 @@
+-- +goose Up
+
+-- リビジョンの本文のYAML front matter（JSON）
+ALTER TABLE note_revisions ADD COLUMN front_matter JSON DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE note_revisions DROP COLUMN front_matter;
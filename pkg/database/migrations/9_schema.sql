@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- note_linksテーブル（ノートの最新リビジョンの本文中にある他のノートへのリンク）
+CREATE TABLE IF NOT EXISTS note_links (
+    source_note_id VARCHAR(36) NOT NULL, -- リンク元のノート
+    position INT NOT NULL, -- 本文中での出現順
+    revision_id VARCHAR(36) NOT NULL, -- リンクを抽出したリビジョン
+    raw VARCHAR(255) NOT NULL, -- 本文中での表記
+    target_title VARCHAR(255) DEFAULT NULL, -- [[タイトル]]の形式の場合のタイトル
+    target_note_id VARCHAR(36) DEFAULT NULL, -- リンク先のノート．タイトルに一致するノートがない場合はNULL
+    broken BOOLEAN NOT NULL DEFAULT FALSE, -- リンク先が存在しないか削除されている
+    PRIMARY KEY (source_note_id, position),
+    INDEX idx_target_note_id (target_note_id),
+    INDEX idx_target_title (target_title)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS note_links;